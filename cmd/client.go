@@ -0,0 +1,500 @@
+package cmd
+
+import (
+	"bytes"
+	"cube/config"
+	"cube/manager"
+	"cube/node"
+	"cube/spec"
+	"cube/task"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+type client struct {
+	manager   string
+	namespace string
+	output    string
+}
+
+func clientFlags(name string) (*flag.FlagSet, *client) {
+	c := &client{}
+	d, err := config.LoadClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ignoring client environment: %v\n", err)
+		d = config.DefaultClient()
+	}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&c.manager, "manager", d.Manager, "manager host:port (CUBE_MANAGER)")
+	fs.StringVar(&c.namespace, "namespace", d.Namespace, "namespace of tasks and services (CUBE_NAMESPACE)")
+	fs.StringVar(&c.output, "o", "table", "output format: table or json")
+	return fs, c
+}
+
+func (c *client) url(path string) string {
+	return fmt.Sprintf("http://%s%s", c.manager, path)
+}
+
+// namespaced returns the path of a namespaced resource in the namespace of
+// the client.
+func (c *client) namespaced(path string) string {
+	return fmt.Sprintf("/namespaces/%s%s", c.namespace, path)
+}
+
+func (c *client) do(method string, path string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequest(method, c.url(path), body)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to reach manager at %s: %v", c.manager, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		e := manager.ErrResponse{}
+		if json.NewDecoder(resp.Body).Decode(&e) == nil && e.Message != "" {
+			return fmt.Errorf("manager returned %d: %s", resp.StatusCode, strings.TrimSpace(e.Message))
+		}
+		return fmt.Errorf("manager returned %d", resp.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *client) print(v interface{}, header string, rows [][]string) error {
+	if c.output == "json" {
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		return e.Encode(v)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, header)
+	for _, r := range rows {
+		fmt.Fprintln(tw, strings.Join(r, "\t"))
+	}
+	return tw.Flush()
+}
+
+func runRun(args []string) error {
+	fs, c := clientFlags("run")
+	file := fs.String("f", "", "spec file to apply, - for stdin")
+	image := fs.String("image", "", "image of a task to start when no spec file is given")
+	name := fs.String("name", "", "name of the task to start")
+	ports := fs.String("ports", "", "comma separated ports the task exposes, e.g. 80/tcp")
+	dryRun := fs.Bool("dry-run", false, "show where the tasks would be placed without starting them")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	switch {
+	case *file == "-":
+		data, err = io.ReadAll(os.Stdin)
+	case *file != "":
+		data, err = os.ReadFile(*file)
+	case *image != "":
+		if *name == "" {
+			return errors.New("-name is required with -image")
+		}
+		r := spec.Resource{Kind: spec.KindTask, Name: *name, Spec: spec.ResourceSpec{Image: *image}}
+		if *ports != "" {
+			r.Spec.Ports = strings.Split(*ports, ",")
+		}
+		data, err = yaml.Marshal(r)
+	default:
+		return errors.New("either -f or -image is required")
+	}
+	if err != nil {
+		return err
+	}
+
+	if *dryRun {
+		var placements []manager.Placement
+		err = c.do("POST", c.namespaced("/dry-run"), bytes.NewReader(data), &placements)
+		if err != nil {
+			return err
+		}
+		var rows [][]string
+		for _, p := range placements {
+			node := p.Node
+			if node == "" {
+				node = "<none>"
+			}
+			rows = append(rows, []string{p.Kind, p.Name, fmt.Sprint(p.Replica), node, p.Attempt.Error})
+		}
+		return c.print(placements, "KIND\tNAME\tREPLICA\tNODE\tERROR", rows)
+	}
+
+	var diffs []manager.ResourceDiff
+	err = c.do("POST", c.namespaced("/apply"), bytes.NewReader(data), &diffs)
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, d := range diffs {
+		rows = append(rows, []string{d.Kind, d.Name, d.Action})
+	}
+	return c.print(diffs, "KIND\tNAME\tACTION", rows)
+}
+
+func runStop(args []string) error {
+	fs, c := clientFlags("stop")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: cube stop [flags] <task ID or name>")
+		fs.PrintDefaults()
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("a task ID or name is required")
+	}
+
+	target := fs.Arg(0)
+	path := fmt.Sprintf("/specs/task/%s", target)
+	if id, err := uuid.Parse(target); err == nil {
+		path = fmt.Sprintf("/tasks/%s", id)
+	}
+	err = c.do("DELETE", c.namespaced(path), nil, nil)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Stopping task %s\n", target)
+	return nil
+}
+
+func formatPorts(t *task.Task) string {
+	var ports []string
+	for containerPort, bindings := range t.HostPorts {
+		if len(bindings) > 0 {
+			ports = append(ports, fmt.Sprintf("%s->%s", bindings[0].HostPort, containerPort))
+		}
+	}
+	sort.Strings(ports)
+	return strings.Join(ports, ",")
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format(time.RFC3339)
+}
+
+func runStatus(args []string) error {
+	fs, c := clientFlags("status")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	var tasks []*task.Task
+	err = c.do("GET", c.namespaced("/tasks"), nil, &tasks)
+	if err != nil {
+		return err
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Name < tasks[j].Name })
+
+	var rows [][]string
+	for _, t := range tasks {
+		rows = append(rows, []string{t.ID.String(), t.Name, t.State.String(), t.Image, t.Service, formatPorts(t), formatTime(t.StartTime)})
+	}
+	return c.print(tasks, "ID\tNAME\tSTATE\tIMAGE\tSERVICE\tPORTS\tSTARTED", rows)
+}
+
+// runExplain shows why the last scheduling attempt of a task placed it
+// where it did, or why it could not be placed.
+func runExplain(args []string) error {
+	fs, c := clientFlags("explain")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: cube explain [flags] <task ID or name>")
+		fs.PrintDefaults()
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("a task ID or name is required")
+	}
+
+	var tasks []*task.Task
+	err = c.do("GET", c.namespaced("/tasks"), nil, &tasks)
+	if err != nil {
+		return err
+	}
+	var t *task.Task
+	for _, candidate := range tasks {
+		if candidate.ID.String() == fs.Arg(0) || (candidate.Name == fs.Arg(0) && (t == nil || isNewer(candidate, t))) {
+			t = candidate
+		}
+	}
+	if t == nil {
+		return fmt.Errorf("task %s not found", fs.Arg(0))
+	}
+	if len(t.Scheduling) == 0 {
+		return fmt.Errorf("task %s has not been scheduled yet", fs.Arg(0))
+	}
+	a := t.Scheduling[len(t.Scheduling)-1]
+	if c.output == "json" {
+		return c.print(a, "", nil)
+	}
+
+	result := "placed on " + a.Node
+	if a.Node == "" {
+		result = "not placed: " + a.Error
+	}
+	fmt.Printf("task %s, scheduler %s, %s, %s\n", t.ID, a.Scheduler, formatTime(a.Time), result)
+	var rows [][]string
+	for name, reason := range a.Filtered {
+		rows = append(rows, []string{name, "filtered", "", reason})
+	}
+	for name, breakdown := range a.Scores {
+		var total float64
+		var parts []string
+		for plugin, v := range breakdown {
+			total += v
+			parts = append(parts, fmt.Sprintf("%s=%.3f", plugin, v))
+		}
+		sort.Strings(parts)
+		result := "candidate"
+		if name == a.Node {
+			result = "selected"
+		}
+		rows = append(rows, []string{name, result, fmt.Sprintf("%.3f", total), strings.Join(parts, " ")})
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i][0] < rows[j][0] })
+	return c.print(a, "NODE\tRESULT\tSCORE\tDETAILS", rows)
+}
+
+// isNewer reports whether a was scheduled after b, for picking the latest
+// of several tasks with the same name.
+func isNewer(a, b *task.Task) bool {
+	if len(a.Scheduling) == 0 || len(b.Scheduling) == 0 {
+		return len(a.Scheduling) > 0
+	}
+	return a.Scheduling[len(a.Scheduling)-1].Time.After(b.Scheduling[len(b.Scheduling)-1].Time)
+}
+
+func runLogs(args []string) error {
+	fs, c := clientFlags("logs")
+	follow := fs.Bool("f", false, "follow the log output")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: cube logs [flags] <task ID>")
+		fs.PrintDefaults()
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("a task ID is required")
+	}
+	id, err := uuid.Parse(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("invalid task ID %s", fs.Arg(0))
+	}
+
+	resp, err := http.Get(c.url(c.namespaced(fmt.Sprintf("/tasks/%s/logs?follow=%t", id, *follow))))
+	if err != nil {
+		return fmt.Errorf("unable to reach manager at %s: %v", c.manager, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		e := manager.ErrResponse{}
+		json.NewDecoder(resp.Body).Decode(&e)
+		return fmt.Errorf("manager returned %d: %s", resp.StatusCode, strings.TrimSpace(e.Message))
+	}
+	_, err = io.Copy(os.Stdout, resp.Body)
+	return err
+}
+
+func runNodes(args []string) error {
+	fs, c := clientFlags("nodes")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	var nodes []*node.Node
+	err = c.do("GET", "/nodes", nil, &nodes)
+	if err != nil {
+		return err
+	}
+
+	var rows [][]string
+	for _, n := range nodes {
+		status := n.Status.String()
+		if n.Unschedulable {
+			status += ",SchedulingDisabled"
+		}
+		rows = append(rows, []string{n.Name, status, fmt.Sprintf("%g/%g", n.CpuAllocated, n.Cpu), fmt.Sprintf("%d/%d", n.MemoryAllocated, n.Memory), fmt.Sprintf("%d/%d", n.DiskAllocated, n.Disk), fmt.Sprintf("%d", n.TaskCount), formatLabels(n.Labels), formatTaints(n.Taints)})
+	}
+	return c.print(nodes, "NAME\tSTATUS\tCPU\tMEMORY\tDISK\tTASKS\tLABELS\tTAINTS", rows)
+}
+
+// nodeCommand parses the flags of a command that takes a single node name.
+func nodeCommand(name string, args []string, flags func(fs *flag.FlagSet)) (*client, string, error) {
+	fs, c := clientFlags(name)
+	if flags != nil {
+		flags(fs)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: cube %s [flags] <node>\n", name)
+		fs.PrintDefaults()
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, "", err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return nil, "", errors.New("a node name is required")
+	}
+	return c, fs.Arg(0), nil
+}
+
+func runCordon(args []string) error {
+	c, name, err := nodeCommand("cordon", args, nil)
+	if err != nil {
+		return err
+	}
+	err = c.do("POST", fmt.Sprintf("/nodes/%s/cordon", name), nil, nil)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("node %s cordoned\n", name)
+	return nil
+}
+
+func runUncordon(args []string) error {
+	c, name, err := nodeCommand("uncordon", args, nil)
+	if err != nil {
+		return err
+	}
+	err = c.do("POST", fmt.Sprintf("/nodes/%s/uncordon", name), nil, nil)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("node %s uncordoned\n", name)
+	return nil
+}
+
+func runDrain(args []string) error {
+	var wait *bool
+	c, name, err := nodeCommand("drain", args, func(fs *flag.FlagSet) {
+		wait = fs.Bool("wait", false, "wait until the node is drained, printing progress")
+	})
+	if err != nil {
+		return err
+	}
+
+	var d manager.Drain
+	err = c.do("POST", fmt.Sprintf("/nodes/%s/drain", name), nil, &d)
+	for err == nil {
+		if c.output == "json" {
+			c.print(d, "", nil)
+		} else {
+			fmt.Printf("node %s: %v, %d of %d tasks evicted, %d remaining\n", d.Node, d.State, d.Evicted, d.Total, d.Remaining)
+			for _, b := range d.Blocked {
+				fmt.Printf("  waiting: %s\n", b)
+			}
+		}
+		if !*wait || d.State != manager.Draining {
+			break
+		}
+		time.Sleep(2 * time.Second)
+		err = c.do("GET", fmt.Sprintf("/nodes/%s/drain", name), nil, &d)
+	}
+	return err
+}
+
+// runTaint adds a taint written as key=value:Effect to a node, or removes
+// the taints with a key when written as key- or key:Effect-.
+func runTaint(args []string) error {
+	fs, c := clientFlags("taint")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: cube taint [flags] <node> <key=value:Effect | key[:Effect]->\n")
+		fs.PrintDefaults()
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("a node name and a taint are required")
+	}
+	name, arg := fs.Arg(0), fs.Arg(1)
+
+	var n node.Node
+	if key, ok := strings.CutSuffix(arg, "-"); ok {
+		key, effect, _ := strings.Cut(key, ":")
+		path := fmt.Sprintf("/nodes/%s/taints/%s", name, url.PathEscape(key))
+		if effect != "" {
+			path += "?effect=" + url.QueryEscape(effect)
+		}
+		err = c.do("DELETE", path, nil, &n)
+	} else {
+		var taint node.Taint
+		taint, err = node.ParseTaint(arg)
+		if err != nil {
+			return err
+		}
+		body, _ := json.Marshal(taint)
+		err = c.do("POST", fmt.Sprintf("/nodes/%s/taints", name), bytes.NewReader(body), &n)
+	}
+	if err != nil {
+		return err
+	}
+	if c.output == "json" {
+		return c.print(n, "", nil)
+	}
+	fmt.Printf("node %s tainted: %s\n", name, formatTaints(n.Taints))
+	return nil
+}
+
+func formatTaints(taints []node.Taint) string {
+	if len(taints) == 0 {
+		return "<none>"
+	}
+	var s []string
+	for _, t := range taints {
+		s = append(s, t.String())
+	}
+	return strings.Join(s, ",")
+}
+
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return "<none>"
+	}
+	var pairs []string
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+const usage = `Usage: cube <command> [flags]
+
+Server commands:
+  manager   run the cube manager
+  worker    run a cube worker
+
+Client commands:
+  run       apply a spec file or start a task from an image
+  stop      stop a task by ID or name
+  status    list tasks
+  logs      print the logs of a task
+  nodes     list worker nodes
+  cordon    stop scheduling tasks on a node
+  uncordon  allow scheduling tasks on a node again
+  drain     cordon a node and move its tasks to other nodes
+  taint     add or remove a taint on a node
+  explain   show why a task was placed where it was
+
+Run 'cube <command> -h' for the flags of a command.
+`
+
+type command func(args []string) error
+
+var commands = map[string]command{
+	"manager":  runManager,
+	"worker":   runWorker,
+	"run":      runRun,
+	"stop":     runStop,
+	"status":   runStatus,
+	"logs":     runLogs,
+	"nodes":    runNodes,
+	"cordon":   runCordon,
+	"uncordon": runUncordon,
+	"drain":    runDrain,
+	"taint":    runTaint,
+	"explain":  runExplain,
+}
+
+func Execute(args []string) error {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		fmt.Fprint(os.Stderr, usage)
+		if len(args) == 0 {
+			return errors.New("no command given")
+		}
+		return nil
+	}
+	c, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	err := c(args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	return err
+}
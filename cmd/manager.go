@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"cube/config"
+	"cube/discovery"
+	"cube/manager"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+type managerFlags struct {
+	fs          *flag.FlagSet
+	config      *string
+	host        *string
+	port        *int
+	workers     *string
+	scheduler   *string
+	dbType      *string
+	dnsPort     *int
+	ingressPort *int
+}
+
+func newManagerFlags() *managerFlags {
+	d := config.DefaultManager()
+	fs := flag.NewFlagSet("manager", flag.ContinueOnError)
+	return &managerFlags{
+		fs:          fs,
+		config:      fs.String("config", os.Getenv("CUBE_CONFIG"), "config file (CUBE_CONFIG)"),
+		host:        fs.String("host", d.Host, "address the manager API listens on (CUBE_MANAGER_HOST)"),
+		port:        fs.Int("port", d.Port, "port the manager API listens on (CUBE_MANAGER_PORT)"),
+		workers:     fs.String("workers", strings.Join(d.Workers, ","), "comma separated list of worker host:port (CUBE_WORKERS)"),
+		scheduler:   fs.String("scheduler", d.Scheduler, "scheduler to use: epvm, roundrobin, mostallocated or leastallocated (CUBE_SCHEDULER)"),
+		dbType:      fs.String("dbtype", d.Store.Type, "store type: memory or persistent (CUBE_MANAGER_DBTYPE)"),
+		dnsPort:     fs.Int("dns-port", d.DNSPort, "port of the embedded DNS server (CUBE_DNS_PORT)"),
+		ingressPort: fs.Int("ingress-port", d.IngressPort, "port of the HTTP ingress proxy (CUBE_INGRESS_PORT)"),
+	}
+}
+
+// load builds the configuration from defaults, the config file, the
+// environment and finally the flags given on the command line.
+func (f *managerFlags) load() (config.Manager, error) {
+	c, err := config.LoadManager(*f.config)
+	if err != nil {
+		return c, err
+	}
+	f.fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "host":
+			c.Host = *f.host
+		case "port":
+			c.Port = *f.port
+		case "workers":
+			c.Workers = config.SplitList(*f.workers)
+		case "scheduler":
+			c.Scheduler = *f.scheduler
+		case "dbtype":
+			c.Store.Type = *f.dbType
+		case "dns-port":
+			c.DNSPort = *f.dnsPort
+		case "ingress-port":
+			c.IngressPort = *f.ingressPort
+		}
+	})
+	return c, c.Validate()
+}
+
+func runManager(args []string) error {
+	f := newManagerFlags()
+	err := f.fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	c, err := f.load()
+	if err != nil {
+		return fmt.Errorf("invalid manager configuration: %v", err)
+	}
+
+	log.Println("Starting Cube manager")
+	m := manager.New(c)
+	mapi := manager.Api{Address: c.Host, Port: c.Port, Manager: m}
+
+	go m.ProcessTasks()
+	go m.UpdateTasks()
+	go m.DoHealthChecks()
+	go m.ProcessWorkflows()
+	go m.ReconcileServices()
+	go m.AutoscaleServices()
+	go m.SyncEndpoints()
+	go m.MonitorNodes()
+
+	dns := discovery.DNSServer{Address: fmt.Sprintf("%s:%d", c.Host, c.DNSPort), Domain: c.Domain, Registry: m.Registry}
+	go func() {
+		err := dns.ListenAndServe()
+		if err != nil {
+			log.Printf("Error starting DNS server: %v", err)
+		}
+	}()
+
+	m.Ingress.Address = fmt.Sprintf("%s:%d", c.Host, c.IngressPort)
+	go func() {
+		err := m.Ingress.ListenAndServe()
+		if err != nil {
+			log.Printf("Error starting ingress proxy: %v", err)
+		}
+	}()
+
+	m.L4.Host = c.Host
+	go m.L4.Run()
+
+	go func() {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		for range hup {
+			log.Println("Received SIGHUP, reloading configuration")
+			c, err := f.load()
+			if err != nil {
+				log.Printf("Not reloading invalid configuration: %v", err)
+				continue
+			}
+			m.Reload(c)
+		}
+	}()
+
+	mapi.Start()
+	return nil
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestManagerFlagsLayering(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string
+		args    []string
+		workers []string
+	}{
+		{"defaults", "", nil, []string{"localhost:5555"}},
+		{"env without flag", "w1:5555,w2:5555", nil, []string{"w1:5555", "w2:5555"}},
+		{"flag over env", "w1:5555", []string{"-workers", "w3:5555"}, []string{"w3:5555"}},
+		{"empty flag", "w1:5555", []string{"-workers", ""}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CUBE_WORKERS", tt.env)
+			f := newManagerFlags()
+			err := f.fs.Parse(tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c, err := f.load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(c.Workers, tt.workers) {
+				t.Errorf("workers = %v, want %v", c.Workers, tt.workers)
+			}
+		})
+	}
+}
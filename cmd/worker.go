@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"cube/config"
+	"cube/worker"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+type workerFlags struct {
+	fs        *flag.FlagSet
+	config    *string
+	host      *string
+	port      *int
+	name      *string
+	dbType    *string
+	manager   *string
+	advertise *string
+	labels    *string
+	taints    *string
+}
+
+func newWorkerFlags() *workerFlags {
+	d := config.DefaultWorker()
+	fs := flag.NewFlagSet("worker", flag.ContinueOnError)
+	return &workerFlags{
+		fs:        fs,
+		config:    fs.String("config", os.Getenv("CUBE_CONFIG"), "config file (CUBE_CONFIG)"),
+		host:      fs.String("host", d.Host, "address the worker API listens on (CUBE_WORKER_HOST)"),
+		port:      fs.Int("port", d.Port, "port the worker API listens on (CUBE_WORKER_PORT)"),
+		name:      fs.String("name", "", "worker name, defaults to worker-<port> (CUBE_WORKER_NAME)"),
+		dbType:    fs.String("dbtype", d.Store.Type, "store type: memory or persistent (CUBE_WORKER_DBTYPE)"),
+		manager:   fs.String("manager", "", "manager address to register with, host:port (CUBE_MANAGER)"),
+		advertise: fs.String("advertise", "", "address the manager reaches the worker on, defaults to host:port (CUBE_WORKER_ADVERTISE)"),
+		labels:    fs.String("labels", "", "node labels, key=value,... (CUBE_WORKER_LABELS)"),
+		taints:    fs.String("taints", "", "node taints, key=value:Effect,... (CUBE_WORKER_TAINTS)"),
+	}
+}
+
+// load builds the configuration from defaults, the config file, the
+// environment and finally the flags given on the command line.
+func (f *workerFlags) load() (config.Worker, error) {
+	c, err := config.LoadWorker(*f.config)
+	if err != nil {
+		return c, err
+	}
+	var labelErr error
+	f.fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "host":
+			c.Host = *f.host
+		case "port":
+			c.Port = *f.port
+		case "name":
+			c.Name = *f.name
+		case "dbtype":
+			c.Store.Type = *f.dbType
+		case "manager":
+			c.Manager = *f.manager
+		case "advertise":
+			c.Advertise = *f.advertise
+		case "labels":
+			labels, err := config.ParseLabels(*f.labels)
+			if err != nil {
+				labelErr = fmt.Errorf("invalid -labels: %v", err)
+				return
+			}
+			c.Labels = labels
+		case "taints":
+			c.Taints = config.SplitList(*f.taints)
+		}
+	})
+	if labelErr != nil {
+		return c, labelErr
+	}
+	if c.Name == "" {
+		c.Name = fmt.Sprintf("worker-%d", c.Port)
+	}
+	if c.Advertise == "" {
+		c.Advertise = fmt.Sprintf("%s:%d", c.Host, c.Port)
+	}
+	return c, c.Validate()
+}
+
+func runWorker(args []string) error {
+	f := newWorkerFlags()
+	err := f.fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	c, err := f.load()
+	if err != nil {
+		return fmt.Errorf("invalid worker configuration: %v", err)
+	}
+
+	log.Printf("Starting Cube worker %s", c.Name)
+	w := worker.New(c)
+	wapi := worker.Api{Address: c.Host, Port: c.Port, Worker: w}
+
+	go w.RunTasks()
+	go w.UpdateTasks()
+	go w.CollectStats()
+	go w.Heartbeats()
+
+	go func() {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		for range hup {
+			log.Println("Received SIGHUP, reloading configuration")
+			c, err := f.load()
+			if err != nil {
+				log.Printf("Not reloading invalid configuration: %v", err)
+				continue
+			}
+			w.Reload(c)
+		}
+	}()
+
+	wapi.Start()
+	return nil
+}
@@ -0,0 +1,460 @@
+package config
+
+import (
+	"cube/node"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Duration is a time.Duration written as a string such as 10s or 1m30s in
+// configuration files.
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	err := value.Decode(&s)
+	if err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %v", s, err)
+	}
+	d.Duration = v
+	return nil
+}
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(d.String())), nil
+}
+
+type ManagerStore struct {
+	Type      string `yaml:"type"`
+	TaskFile  string `yaml:"taskFile"`
+	EventFile string `yaml:"eventFile"`
+}
+
+type ManagerIntervals struct {
+	ProcessTasks Duration `yaml:"processTasks"`
+	UpdateTasks  Duration `yaml:"updateTasks"`
+	HealthChecks Duration `yaml:"healthChecks"`
+	Workflows    Duration `yaml:"workflows"`
+	Reconcile    Duration `yaml:"reconcile"`
+	Autoscale    Duration `yaml:"autoscale"`
+	Endpoints    Duration `yaml:"endpoints"`
+	NodeMonitor  Duration `yaml:"nodeMonitor"`
+}
+
+// ManagerNodes controls how heartbeat age maps to node status: a node is
+// NotReady once its last heartbeat is older than NotReadyAfter and Unknown
+// once it is older than UnknownAfter or MaxPollFailures polls in a row
+// failed. The tasks of an Unknown node are rescheduled.
+type ManagerNodes struct {
+	NotReadyAfter   Duration `yaml:"notReadyAfter"`
+	UnknownAfter    Duration `yaml:"unknownAfter"`
+	MaxPollFailures int      `yaml:"maxPollFailures"`
+}
+
+// SchedulerProfile assembles a scheduler from filter and weighted score
+// plugins. Without filters the built-in ones are used.
+type SchedulerProfile struct {
+	Filters []string      `yaml:"filters"`
+	Scores  []ScoreWeight `yaml:"scores"`
+}
+
+type ScoreWeight struct {
+	Plugin string  `yaml:"plugin"`
+	Weight float64 `yaml:"weight"`
+}
+
+type Manager struct {
+	Host        string                      `yaml:"host"`
+	Port        int                         `yaml:"port"`
+	Workers     []string                    `yaml:"workers"`
+	Scheduler   string                      `yaml:"scheduler"`
+	Profiles    map[string]SchedulerProfile `yaml:"profiles"`
+	Store       ManagerStore                `yaml:"store"`
+	DNSPort     int                         `yaml:"dnsPort"`
+	IngressPort int                         `yaml:"ingressPort"`
+	Domain      string                      `yaml:"domain"`
+	Intervals   ManagerIntervals            `yaml:"intervals"`
+	Nodes       ManagerNodes                `yaml:"nodes"`
+}
+
+type WorkerStore struct {
+	Type     string `yaml:"type"`
+	TaskFile string `yaml:"taskFile"`
+}
+
+type WorkerIntervals struct {
+	RunTasks     Duration `yaml:"runTasks"`
+	UpdateTasks  Duration `yaml:"updateTasks"`
+	CollectStats Duration `yaml:"collectStats"`
+	Heartbeat    Duration `yaml:"heartbeat"`
+}
+
+type Worker struct {
+	Host      string            `yaml:"host"`
+	Port      int               `yaml:"port"`
+	Name      string            `yaml:"name"`
+	Manager   string            `yaml:"manager"`
+	Advertise string            `yaml:"advertise"`
+	Labels    map[string]string `yaml:"labels"`
+	Taints    []string          `yaml:"taints"`
+	Store     WorkerStore       `yaml:"store"`
+	Intervals WorkerIntervals   `yaml:"intervals"`
+}
+
+// Client holds the settings of the client commands.
+type Client struct {
+	Manager   string
+	Namespace string
+}
+
+type File struct {
+	Manager Manager `yaml:"manager"`
+	Worker  Worker  `yaml:"worker"`
+}
+
+func seconds(n int) Duration {
+	return Duration{time.Duration(n) * time.Second}
+}
+
+func DefaultManager() Manager {
+	return Manager{
+		Host:      "localhost",
+		Port:      5556,
+		Workers:   []string{"localhost:5555"},
+		Scheduler: "epvm",
+		Store: ManagerStore{
+			Type:      "persistent",
+			TaskFile:  "tasks.db",
+			EventFile: "events.db",
+		},
+		DNSPort:     5353,
+		IngressPort: 8080,
+		Domain:      "cube.local",
+		Intervals: ManagerIntervals{
+			ProcessTasks: seconds(10),
+			UpdateTasks:  seconds(15),
+			HealthChecks: seconds(60),
+			Workflows:    seconds(10),
+			Reconcile:    seconds(15),
+			Autoscale:    seconds(30),
+			Endpoints:    seconds(10),
+			NodeMonitor:  seconds(5),
+		},
+		Nodes: ManagerNodes{
+			NotReadyAfter:   seconds(40),
+			UnknownAfter:    seconds(300),
+			MaxPollFailures: 3,
+		},
+	}
+}
+
+func DefaultClient() Client {
+	return Client{
+		Manager:   "localhost:5556",
+		Namespace: "default",
+	}
+}
+
+func DefaultWorker() Worker {
+	return Worker{
+		Host: "localhost",
+		Port: 5555,
+		Store: WorkerStore{
+			Type: "memory",
+		},
+		Intervals: WorkerIntervals{
+			RunTasks:     seconds(10),
+			UpdateTasks:  seconds(15),
+			CollectStats: seconds(15),
+			Heartbeat:    seconds(10),
+		},
+	}
+}
+
+// readFile overlays the settings found in the file at path on f. Settings
+// missing from the file keep their current value.
+func readFile(path string, f *File) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read config file: %v", err)
+	}
+	err = yaml.Unmarshal(data, f)
+	if err != nil {
+		return fmt.Errorf("unable to parse config file %s: %v", path, err)
+	}
+	return nil
+}
+
+type envSetter func(string) error
+
+func stringVar(p *string) envSetter {
+	return func(v string) error {
+		*p = v
+		return nil
+	}
+}
+
+func intVar(p *int) envSetter {
+	return func(v string) error {
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		*p = i
+		return nil
+	}
+}
+
+func durationVar(p *Duration) envSetter {
+	return func(v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		p.Duration = d
+		return nil
+	}
+}
+
+func listVar(p *[]string) envSetter {
+	return func(v string) error {
+		*p = SplitList(v)
+		return nil
+	}
+}
+
+func labelsVar(p *map[string]string) envSetter {
+	return func(v string) error {
+		labels, err := ParseLabels(v)
+		if err != nil {
+			return err
+		}
+		*p = labels
+		return nil
+	}
+}
+
+func applyEnv(vars map[string]envSetter) error {
+	for key, set := range vars {
+		v, ok := os.LookupEnv(key)
+		if !ok || v == "" {
+			continue
+		}
+		err := set(v)
+		if err != nil {
+			return fmt.Errorf("invalid value %q for %s: %v", v, key, err)
+		}
+	}
+	return nil
+}
+
+// SplitList splits a comma separated list, dropping empty entries.
+func SplitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// ParseLabels parses a comma separated list of key=value pairs. A key
+// without a value gets an empty one.
+func ParseLabels(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, kv := range SplitList(s) {
+		k, v, _ := strings.Cut(kv, "=")
+		k = strings.TrimSpace(k)
+		if k == "" {
+			return nil, fmt.Errorf("invalid label %q", kv)
+		}
+		labels[k] = strings.TrimSpace(v)
+	}
+	return labels, nil
+}
+
+// LoadManager merges the defaults, the config file at path (if any) and
+// CUBE_* environment variables. Flags are applied on top by the caller.
+func LoadManager(path string) (Manager, error) {
+	f := File{Manager: DefaultManager()}
+	err := readFile(path, &f)
+	if err != nil {
+		return Manager{}, err
+	}
+	c := f.Manager
+	err = applyEnv(map[string]envSetter{
+		"CUBE_MANAGER_HOST":           stringVar(&c.Host),
+		"CUBE_MANAGER_PORT":           intVar(&c.Port),
+		"CUBE_WORKERS":                listVar(&c.Workers),
+		"CUBE_SCHEDULER":              stringVar(&c.Scheduler),
+		"CUBE_MANAGER_DBTYPE":         stringVar(&c.Store.Type),
+		"CUBE_MANAGER_TASK_DB":        stringVar(&c.Store.TaskFile),
+		"CUBE_MANAGER_EVENT_DB":       stringVar(&c.Store.EventFile),
+		"CUBE_DNS_PORT":               intVar(&c.DNSPort),
+		"CUBE_INGRESS_PORT":           intVar(&c.IngressPort),
+		"CUBE_DOMAIN":                 stringVar(&c.Domain),
+		"CUBE_PROCESS_TASKS_INTERVAL": durationVar(&c.Intervals.ProcessTasks),
+		"CUBE_UPDATE_TASKS_INTERVAL":  durationVar(&c.Intervals.UpdateTasks),
+		"CUBE_HEALTH_CHECK_INTERVAL":  durationVar(&c.Intervals.HealthChecks),
+		"CUBE_WORKFLOW_INTERVAL":      durationVar(&c.Intervals.Workflows),
+		"CUBE_RECONCILE_INTERVAL":     durationVar(&c.Intervals.Reconcile),
+		"CUBE_AUTOSCALE_INTERVAL":     durationVar(&c.Intervals.Autoscale),
+		"CUBE_ENDPOINTS_INTERVAL":     durationVar(&c.Intervals.Endpoints),
+		"CUBE_NODE_MONITOR_INTERVAL":  durationVar(&c.Intervals.NodeMonitor),
+		"CUBE_NODE_NOT_READY_AFTER":   durationVar(&c.Nodes.NotReadyAfter),
+		"CUBE_NODE_UNKNOWN_AFTER":     durationVar(&c.Nodes.UnknownAfter),
+		"CUBE_NODE_MAX_POLL_FAILURES": intVar(&c.Nodes.MaxPollFailures),
+	})
+	return c, err
+}
+
+// LoadClient merges the client defaults and CUBE_* environment variables.
+func LoadClient() (Client, error) {
+	c := DefaultClient()
+	err := applyEnv(map[string]envSetter{
+		"CUBE_MANAGER":   stringVar(&c.Manager),
+		"CUBE_NAMESPACE": stringVar(&c.Namespace),
+	})
+	return c, err
+}
+
+// LoadWorker is the worker counterpart of LoadManager.
+func LoadWorker(path string) (Worker, error) {
+	f := File{Worker: DefaultWorker()}
+	err := readFile(path, &f)
+	if err != nil {
+		return Worker{}, err
+	}
+	c := f.Worker
+	err = applyEnv(map[string]envSetter{
+		"CUBE_WORKER_HOST":                  stringVar(&c.Host),
+		"CUBE_WORKER_PORT":                  intVar(&c.Port),
+		"CUBE_WORKER_NAME":                  stringVar(&c.Name),
+		"CUBE_MANAGER":                      stringVar(&c.Manager),
+		"CUBE_WORKER_ADVERTISE":             stringVar(&c.Advertise),
+		"CUBE_WORKER_LABELS":                labelsVar(&c.Labels),
+		"CUBE_WORKER_TAINTS":                listVar(&c.Taints),
+		"CUBE_HEARTBEAT_INTERVAL":           durationVar(&c.Intervals.Heartbeat),
+		"CUBE_WORKER_DBTYPE":                stringVar(&c.Store.Type),
+		"CUBE_WORKER_TASK_DB":               stringVar(&c.Store.TaskFile),
+		"CUBE_RUN_TASKS_INTERVAL":           durationVar(&c.Intervals.RunTasks),
+		"CUBE_WORKER_UPDATE_TASKS_INTERVAL": durationVar(&c.Intervals.UpdateTasks),
+		"CUBE_COLLECT_STATS_INTERVAL":       durationVar(&c.Intervals.CollectStats),
+	})
+	return c, err
+}
+
+func validPort(name string, port int) error {
+	if port <= 0 || port > 65535 {
+		return fmt.Errorf("%s %d is not a valid port", name, port)
+	}
+	return nil
+}
+
+func validStore(storeType string) error {
+	if storeType != "memory" && storeType != "persistent" {
+		return fmt.Errorf("unknown store type %q", storeType)
+	}
+	return nil
+}
+
+func positive(durations map[string]Duration) error {
+	for name, d := range durations {
+		if d.Duration <= 0 {
+			return fmt.Errorf("interval %s must be positive", name)
+		}
+	}
+	return nil
+}
+
+// IsBuiltinScheduler reports whether name is one of the schedulers that
+// need no profile.
+func IsBuiltinScheduler(name string) bool {
+	switch name {
+	case "epvm", "roundrobin", "mostallocated", "leastallocated":
+		return true
+	}
+	return false
+}
+
+func (c *Manager) Validate() error {
+	var errs []error
+	errs = append(errs,
+		validPort("port", c.Port),
+		validPort("dnsPort", c.DNSPort),
+		validPort("ingressPort", c.IngressPort),
+		validStore(c.Store.Type),
+		positive(map[string]Duration{
+			"processTasks":  c.Intervals.ProcessTasks,
+			"updateTasks":   c.Intervals.UpdateTasks,
+			"healthChecks":  c.Intervals.HealthChecks,
+			"workflows":     c.Intervals.Workflows,
+			"reconcile":     c.Intervals.Reconcile,
+			"autoscale":     c.Intervals.Autoscale,
+			"endpoints":     c.Intervals.Endpoints,
+			"nodeMonitor":   c.Intervals.NodeMonitor,
+			"notReadyAfter": c.Nodes.NotReadyAfter,
+			"unknownAfter":  c.Nodes.UnknownAfter,
+		}),
+	)
+	if c.Nodes.MaxPollFailures < 1 {
+		errs = append(errs, errors.New("nodes.maxPollFailures must be at least 1"))
+	}
+	if c.Nodes.UnknownAfter.Duration < c.Nodes.NotReadyAfter.Duration {
+		errs = append(errs, errors.New("nodes.unknownAfter must not be shorter than nodes.notReadyAfter"))
+	}
+	for name := range c.Profiles {
+		if IsBuiltinScheduler(name) {
+			errs = append(errs, fmt.Errorf("profile %s shadows a built-in scheduler", name))
+		}
+	}
+	if _, ok := c.Profiles[c.Scheduler]; !ok && !IsBuiltinScheduler(c.Scheduler) {
+		errs = append(errs, fmt.Errorf("unknown scheduler %q", c.Scheduler))
+	}
+	if c.Store.Type == "persistent" && (c.Store.TaskFile == "" || c.Store.EventFile == "") {
+		errs = append(errs, errors.New("persistent store needs a task and an event file"))
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Worker) Validate() error {
+	var errs []error
+	errs = append(errs,
+		validPort("port", c.Port),
+		validStore(c.Store.Type),
+		positive(map[string]Duration{
+			"runTasks":     c.Intervals.RunTasks,
+			"updateTasks":  c.Intervals.UpdateTasks,
+			"collectStats": c.Intervals.CollectStats,
+			"heartbeat":    c.Intervals.Heartbeat,
+		}),
+	)
+	if c.Name == "" {
+		errs = append(errs, errors.New("worker name is required"))
+	}
+	for _, s := range c.Taints {
+		_, err := node.ParseTaint(s)
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
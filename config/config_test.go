@@ -0,0 +1,76 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "cube.yaml")
+	err := os.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadManagerLayering(t *testing.T) {
+	path := writeConfig(t, `
+manager:
+  port: 6000
+  scheduler: roundrobin
+  workers: [a:5555, b:5555]
+  intervals:
+    reconcile: 2s
+`)
+	t.Setenv("CUBE_MANAGER_PORT", "7000")
+	t.Setenv("CUBE_UPDATE_TASKS_INTERVAL", "3s")
+
+	c, err := LoadManager(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := DefaultManager()
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"port from env over file", c.Port, 7000},
+		{"scheduler from file", c.Scheduler, "roundrobin"},
+		{"workers from file", c.Workers, []string{"a:5555", "b:5555"}},
+		{"interval from file", c.Intervals.Reconcile.Duration, 2 * time.Second},
+		{"interval from env", c.Intervals.UpdateTasks.Duration, 3 * time.Second},
+		{"host from defaults", c.Host, d.Host},
+		{"interval from defaults", c.Intervals.HealthChecks, d.Intervals.HealthChecks},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLoadManagerInvalidEnv(t *testing.T) {
+	t.Setenv("CUBE_MANAGER_PORT", "not-a-port")
+	_, err := LoadManager("")
+	if err == nil {
+		t.Error("expected an error for an invalid port")
+	}
+}
+
+func TestLoadClient(t *testing.T) {
+	t.Setenv("CUBE_NAMESPACE", "team-a")
+	c, err := LoadClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Client{Manager: DefaultClient().Manager, Namespace: "team-a"}
+	if c != want {
+		t.Errorf("LoadClient() = %+v, want %+v", c, want)
+	}
+}
@@ -0,0 +1,185 @@
+package discovery
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const ttl = 5
+
+// DNSServer answers A and SRV queries for names under Domain from the
+// registry. web.cube.local resolves to the hosts of the ready tasks of
+// service or task web, and SRV queries for web.cube.local or
+// _web._tcp.cube.local return one record per endpoint pointing at
+// <task>.web.cube.local. Names outside the default namespace carry it, as
+// in web.team-a.cube.local and _web._tcp.team-a.cube.local.
+type DNSServer struct {
+	Address  string
+	Domain   string
+	Registry *Registry
+}
+
+func (s *DNSServer) domain() string {
+	d := strings.ToLower(strings.Trim(s.Domain, "."))
+	if d == "" {
+		d = "cube.local"
+	}
+	return d + "."
+}
+
+func (s *DNSServer) ListenAndServe() error {
+	conn, err := net.ListenPacket("udp", s.Address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	log.Printf("[dns] serving %s on %s", s.domain(), s.Address)
+
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			log.Printf("[dns] error reading request: %v", err)
+			continue
+		}
+		resp, err := s.handle(buf[:n])
+		if err != nil {
+			log.Printf("[dns] error handling request from %v: %v", addr, err)
+			continue
+		}
+		_, err = conn.WriteTo(resp, addr)
+		if err != nil {
+			log.Printf("[dns] error writing response to %v: %v", addr, err)
+		}
+	}
+}
+
+func taskLabel(e Endpoint) string {
+	return e.TaskID.String()[:8]
+}
+
+func resolveIPv4(host string) net.IP {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		ips, err := net.LookupIP(host)
+		if err != nil {
+			log.Printf("[dns] unable to resolve host %s: %v", host, err)
+			return nil
+		}
+		for _, candidate := range ips {
+			if candidate.To4() != nil {
+				ip = candidate
+				break
+			}
+		}
+	}
+	if ip == nil {
+		return nil
+	}
+	return ip.To4()
+}
+
+// parseName splits a query name of the form [label.]name[.namespace] or
+// _name._proto[.namespace] into the registry name and an optional task
+// label. Since a name may be qualified by its namespace, the registry
+// decides: the whole name is taken if it is registered, otherwise the
+// first label must be a task label in front of a registered name.
+func (s *DNSServer) parseName(name string) (string, string, bool) {
+	name = strings.ToLower(name)
+	if !strings.HasSuffix(name, "."+s.domain()) {
+		return "", "", false
+	}
+	labels := strings.Split(strings.TrimSuffix(name, "."+s.domain()), ".")
+	if len(labels) >= 2 && strings.HasPrefix(labels[0], "_") && strings.HasPrefix(labels[1], "_") {
+		qualified := append([]string{strings.TrimPrefix(labels[0], "_")}, labels[2:]...)
+		return strings.Join(qualified, "."), "", true
+	}
+	if s.Registry.Has(strings.Join(labels, ".")) {
+		return strings.Join(labels, "."), "", true
+	}
+	if len(labels) >= 2 && s.Registry.Has(strings.Join(labels[1:], ".")) {
+		return strings.Join(labels[1:], "."), labels[0], true
+	}
+	return "", "", false
+}
+
+func (s *DNSServer) handle(req []byte) ([]byte, error) {
+	var p dnsmessage.Parser
+	h, err := p.Start(req)
+	if err != nil {
+		return nil, err
+	}
+	q, err := p.Question()
+	if err != nil {
+		return nil, err
+	}
+
+	resp := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:                 h.ID,
+			Response:           true,
+			Authoritative:      true,
+			RecursionDesired:   h.RecursionDesired,
+			RecursionAvailable: false,
+		},
+		Questions: []dnsmessage.Question{q},
+	}
+
+	name, label, ok := s.parseName(q.Name.String())
+	var endpoints []Endpoint
+	if ok {
+		for _, e := range s.Registry.Lookup(name) {
+			if label == "" || taskLabel(e) == label {
+				endpoints = append(endpoints, e)
+			}
+		}
+	}
+	if len(endpoints) == 0 {
+		resp.Header.RCode = dnsmessage.RCodeNameError
+		return resp.Pack()
+	}
+
+	switch q.Type {
+	case dnsmessage.TypeA:
+		seen := make(map[string]bool)
+		for _, e := range endpoints {
+			ip := resolveIPv4(e.Host)
+			if ip == nil || seen[ip.String()] {
+				continue
+			}
+			seen[ip.String()] = true
+			var a [4]byte
+			copy(a[:], ip)
+			resp.Answers = append(resp.Answers, dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: ttl},
+				Body:   &dnsmessage.AResource{A: a},
+			})
+		}
+	case dnsmessage.TypeSRV:
+		for _, e := range endpoints {
+			target, err := dnsmessage.NewName(fmt.Sprintf("%s.%s.%s", taskLabel(e), name, s.domain()))
+			if err != nil {
+				return nil, err
+			}
+			resp.Answers = append(resp.Answers, dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeSRV, Class: dnsmessage.ClassINET, TTL: ttl},
+				Body:   &dnsmessage.SRVResource{Priority: 0, Weight: 10, Port: uint16(e.Port), Target: target},
+			})
+			ip := resolveIPv4(e.Host)
+			if ip == nil {
+				continue
+			}
+			var a [4]byte
+			copy(a[:], ip)
+			resp.Additionals = append(resp.Additionals, dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{Name: target, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: ttl},
+				Body:   &dnsmessage.AResource{A: a},
+			})
+		}
+	}
+	return resp.Pack()
+}
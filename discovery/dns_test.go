@@ -0,0 +1,42 @@
+package discovery
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestParseName(t *testing.T) {
+	r := NewRegistry()
+	r.Update([]Endpoint{
+		{TaskID: uuid.New(), TaskName: "web-1", Service: "web"},
+		{TaskID: uuid.New(), TaskName: "web-1.team-a", Service: "web.team-a"},
+		{TaskID: uuid.New(), TaskName: "job.team-a"},
+	})
+	s := &DNSServer{Domain: "cube.local", Registry: r}
+
+	tests := []struct {
+		query     string
+		wantName  string
+		wantLabel string
+		wantOk    bool
+	}{
+		{"web.cube.local.", "web", "", true},
+		{"WEB.cube.local.", "web", "", true},
+		{"web.team-a.cube.local.", "web.team-a", "", true},
+		{"job.team-a.cube.local.", "job.team-a", "", true},
+		{"0a1b2c3d.web.cube.local.", "web", "0a1b2c3d", true},
+		{"0a1b2c3d.web.team-a.cube.local.", "web.team-a", "0a1b2c3d", true},
+		{"_web._tcp.cube.local.", "web", "", true},
+		{"_web._tcp.team-a.cube.local.", "web.team-a", "", true},
+		{"web.team-b.cube.local.", "", "", false},
+		{"missing.cube.local.", "", "", false},
+		{"web.example.org.", "", "", false},
+	}
+	for _, tt := range tests {
+		name, label, ok := s.parseName(tt.query)
+		if name != tt.wantName || label != tt.wantLabel || ok != tt.wantOk {
+			t.Errorf("parseName(%q) = %q, %q, %v, want %q, %q, %v", tt.query, name, label, ok, tt.wantName, tt.wantLabel, tt.wantOk)
+		}
+	}
+}
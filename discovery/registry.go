@@ -0,0 +1,150 @@
+package discovery
+
+import (
+	"cube/task"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Endpoint is a published port of a ready task. TaskName and Service are
+// qualified with the namespace, see Name.
+type Endpoint struct {
+	TaskID        uuid.UUID
+	TaskName      string
+	Service       string
+	Namespace     string
+	Host          string
+	Port          int
+	ContainerPort string
+}
+
+// Registry holds the endpoints of ready tasks keyed by service name and by
+// task name. The two are kept apart so that a task named like a service
+// cannot shadow it. The manager replaces its contents as tasks move.
+type Registry struct {
+	mu       sync.RWMutex
+	services map[string][]Endpoint
+	tasks    map[string][]Endpoint
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		services: make(map[string][]Endpoint),
+		tasks:    make(map[string][]Endpoint),
+	}
+}
+
+// Name qualifies the name of a task or service outside the default
+// namespace with its namespace, as in web.team-a.
+func Name(namespace, name string) string {
+	if name == "" || task.NamespaceOf(namespace) == task.DefaultNamespace {
+		return name
+	}
+	return name + "." + namespace
+}
+
+func key(name string) string {
+	return strings.ToLower(name)
+}
+
+func sortEndpoints(byName map[string][]Endpoint) {
+	for _, eps := range byName {
+		sort.Slice(eps, func(i, j int) bool {
+			if eps[i].TaskID != eps[j].TaskID {
+				return eps[i].TaskID.String() < eps[j].TaskID.String()
+			}
+			return eps[i].ContainerPort < eps[j].ContainerPort
+		})
+	}
+}
+
+func (r *Registry) Update(endpoints []Endpoint) {
+	services := make(map[string][]Endpoint)
+	tasks := make(map[string][]Endpoint)
+	for _, e := range endpoints {
+		if e.Service != "" {
+			services[key(e.Service)] = append(services[key(e.Service)], e)
+		}
+		if e.TaskName != "" {
+			tasks[key(e.TaskName)] = append(tasks[key(e.TaskName)], e)
+		}
+	}
+	sortEndpoints(services)
+	sortEndpoints(tasks)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.services = services
+	r.tasks = tasks
+}
+
+// Lookup returns the endpoints of the service with the given name, or of
+// the task with that name if there is no such service.
+func (r *Registry) Lookup(name string) []Endpoint {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	eps, ok := r.services[key(name)]
+	if !ok {
+		eps = r.tasks[key(name)]
+	}
+	result := make([]Endpoint, len(eps))
+	copy(result, eps)
+	return result
+}
+
+// Has reports whether a service or task with the given name has endpoints.
+func (r *Registry) Has(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.services[key(name)]
+	if !ok {
+		_, ok = r.tasks[key(name)]
+	}
+	return ok
+}
+
+// LookupIn returns the endpoints of the service or task with the given
+// name in a namespace, like Lookup, leaving out endpoints of other
+// namespaces whose qualified name happens to be the same.
+func (r *Registry) LookupIn(namespace, name string) []Endpoint {
+	namespace = task.NamespaceOf(namespace)
+	endpoints := []Endpoint{}
+	for _, e := range r.Lookup(Name(namespace, name)) {
+		if task.NamespaceOf(e.Namespace) == namespace {
+			endpoints = append(endpoints, e)
+		}
+	}
+	return endpoints
+}
+
+// Names returns the names of the services and tasks with endpoints in a
+// namespace, without the namespace.
+func (r *Registry) Names(namespace string) []string {
+	namespace = task.NamespaceOf(namespace)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	seen := make(map[string]bool)
+	names := []string{}
+	for _, byName := range []map[string][]Endpoint{r.services, r.tasks} {
+		for name, eps := range byName {
+			for _, e := range eps {
+				if task.NamespaceOf(e.Namespace) != namespace {
+					continue
+				}
+				if namespace != task.DefaultNamespace {
+					name = strings.TrimSuffix(name, "."+namespace)
+				}
+				if !seen[name] {
+					seen[name] = true
+					names = append(names, name)
+				}
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,82 @@
+package discovery
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestRegistryLookup(t *testing.T) {
+	web1 := Endpoint{TaskID: uuid.MustParse("00000000-0000-0000-0000-000000000001"), TaskName: "web-1", Service: "web", Port: 8001}
+	web2 := Endpoint{TaskID: uuid.MustParse("00000000-0000-0000-0000-000000000002"), TaskName: "web-2", Service: "web", Port: 8002}
+	// a standalone task named like the service
+	impostor := Endpoint{TaskID: uuid.MustParse("00000000-0000-0000-0000-000000000003"), TaskName: "web", Port: 8003}
+	job := Endpoint{TaskID: uuid.MustParse("00000000-0000-0000-0000-000000000004"), TaskName: "job", Port: 8004}
+
+	r := NewRegistry()
+	r.Update([]Endpoint{web2, impostor, job, web1})
+
+	tests := []struct {
+		name string
+		want []Endpoint
+	}{
+		{"web", []Endpoint{web1, web2}},
+		{"WEB", []Endpoint{web1, web2}},
+		{"web-2", []Endpoint{web2}},
+		{"job", []Endpoint{job}},
+		{"missing", []Endpoint{}},
+	}
+	for _, tt := range tests {
+		got := r.Lookup(tt.name)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Lookup(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	wantNames := []string{"job", "web", "web-1", "web-2"}
+	if got := r.Names(""); !reflect.DeepEqual(got, wantNames) {
+		t.Errorf("Names() = %v, want %v", got, wantNames)
+	}
+}
+
+func TestRegistryNamespaces(t *testing.T) {
+	web := Endpoint{TaskID: uuid.MustParse("00000000-0000-0000-0000-000000000001"), TaskName: "web-1", Service: "web", Namespace: "default"}
+	teamWeb := Endpoint{TaskID: uuid.MustParse("00000000-0000-0000-0000-000000000002"), TaskName: "web-1.team-a", Service: "web.team-a", Namespace: "team-a"}
+	// a default task whose name looks like a name of team-a
+	lookalike := Endpoint{TaskID: uuid.MustParse("00000000-0000-0000-0000-000000000003"), TaskName: "db.team-a", Namespace: "default"}
+
+	r := NewRegistry()
+	r.Update([]Endpoint{web, teamWeb, lookalike})
+
+	tests := []struct {
+		namespace string
+		name      string
+		want      []Endpoint
+	}{
+		{"", "web", []Endpoint{web}},
+		{"default", "web", []Endpoint{web}},
+		{"team-a", "web", []Endpoint{teamWeb}},
+		{"team-a", "web-1", []Endpoint{teamWeb}},
+		{"team-a", "db", []Endpoint{}},
+		{"default", "web.team-a", []Endpoint{}},
+		{"team-b", "web", []Endpoint{}},
+	}
+	for _, tt := range tests {
+		got := r.LookupIn(tt.namespace, tt.name)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("LookupIn(%q, %q) = %v, want %v", tt.namespace, tt.name, got, tt.want)
+		}
+	}
+
+	names := map[string][]string{
+		"default": {"db.team-a", "web", "web-1"},
+		"team-a":  {"web", "web-1"},
+		"team-b":  {},
+	}
+	for namespace, want := range names {
+		if got := r.Names(namespace); !reflect.DeepEqual(got, want) {
+			t.Errorf("Names(%q) = %v, want %v", namespace, got, want)
+		}
+	}
+}
@@ -9,11 +9,83 @@ import (
 
 func (a *Api) initRouter() {
 	a.Router = chi.NewRouter()
-	a.Router.Route("/tasks", func(r chi.Router) {
+	// namespaced resources outside /namespaces belong to the default
+	// namespace
+	a.namespacedRoutes(a.Router)
+	a.Router.Route("/namespaces/{namespace}", func(r chi.Router) {
+		r.Use(validNamespace)
+		a.namespacedRoutes(r)
+	})
+	a.Router.Route("/nodes", func(r chi.Router) {
+		r.Get("/", a.GetNodesHandler)
+		r.Post("/", a.RegisterNodeHandler)
+		r.Route("/{name}", func(r chi.Router) {
+			r.Post("/heartbeat", a.HeartbeatHandler)
+			r.Post("/cordon", a.CordonNodeHandler)
+			r.Post("/uncordon", a.UncordonNodeHandler)
+			r.Post("/drain", a.DrainNodeHandler)
+			r.Get("/drain", a.GetDrainHandler)
+			r.Post("/taints", a.AddTaintHandler)
+			r.Delete("/taints/{key}", a.RemoveTaintHandler)
+		})
+	})
+}
+
+// namespacedRoutes adds the routes of the resources that belong to a
+// namespace.
+func (a *Api) namespacedRoutes(r chi.Router) {
+	r.Route("/tasks", func(r chi.Router) {
 		r.Post("/", a.StartTaskHandler)
 		r.Get("/", a.GetTasksHandler)
 		r.Route("/{taskID}", func(r chi.Router) {
 			r.Delete("/", a.StopTaskHandler)
+			r.Get("/logs", a.GetTaskLogsHandler)
+		})
+	})
+	r.Route("/workflows", func(r chi.Router) {
+		r.Post("/", a.StartWorkflowHandler)
+		r.Get("/", a.GetWorkflowsHandler)
+		r.Route("/{workflowID}", func(r chi.Router) {
+			r.Get("/", a.GetWorkflowHandler)
+		})
+	})
+	r.Route("/discovery", func(r chi.Router) {
+		r.Get("/", a.GetDiscoveryNamesHandler)
+		r.Get("/{name}", a.LookupHandler)
+	})
+	r.Route("/ingresses", func(r chi.Router) {
+		r.Post("/", a.SetIngressHandler)
+		r.Get("/", a.GetIngressesHandler)
+		r.Delete("/{name}", a.DeleteIngressHandler)
+	})
+	r.Route("/loadbalancers", func(r chi.Router) {
+		r.Post("/", a.AddLoadBalancerHandler)
+		r.Get("/", a.GetLoadBalancersHandler)
+		r.Delete("/{name}", a.DeleteLoadBalancerHandler)
+	})
+	r.Get("/quota", a.GetQuotaHandler)
+	r.Put("/quota", a.SetQuotaHandler)
+	r.Delete("/quota", a.SetQuotaHandler)
+	r.Post("/apply", a.ApplyHandler)
+	r.Post("/diff", a.DiffHandler)
+	r.Post("/dry-run", a.DryRunHandler)
+	r.Delete("/specs/{kind}/{name}", a.DeleteResourceHandler)
+	r.Route("/services", func(r chi.Router) {
+		r.Post("/", a.CreateServiceHandler)
+		r.Get("/", a.GetServicesHandler)
+		r.Route("/{serviceName}", func(r chi.Router) {
+			r.Get("/", a.GetServiceHandler)
+			r.Delete("/", a.DeleteServiceHandler)
+			r.Put("/", a.UpdateServiceHandler)
+			r.Put("/scale", a.ScaleServiceHandler)
+			r.Put("/autoscale", a.AutoscaleServiceHandler)
+			r.Delete("/autoscale", a.AutoscaleServiceHandler)
+			r.Put("/disruption", a.DisruptionBudgetHandler)
+			r.Get("/revisions", a.GetServiceRevisionsHandler)
+			r.Post("/rollback", a.RollbackServiceHandler)
+			r.Post("/resume", a.ResumeServiceHandler)
+			r.Post("/promote", a.PromoteServiceHandler)
+			r.Post("/abort", a.AbortServiceHandler)
 		})
 	})
 }
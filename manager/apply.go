@@ -0,0 +1,255 @@
+package manager
+
+import (
+	"cube/spec"
+	"cube/task"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ActionCreate    = "create"
+	ActionUpdate    = "update"
+	ActionUnchanged = "unchanged"
+)
+
+type FieldChange struct {
+	Field   string
+	Current string
+	Desired string
+}
+
+type ResourceDiff struct {
+	Kind    string
+	Name    string
+	Action  string
+	Changes []FieldChange
+}
+
+func serviceSpecFromTask(t task.Task) ServiceSpec {
+	return ServiceSpec{
+		Image:          t.Image,
+		Cpu:            t.Cpu,
+		Memory:         t.Memory,
+		Disk:           t.Disk,
+		ExposedPorts:   t.ExposedPorts,
+		PortBindings:   t.PortBindings,
+		HealthCheck:    t.HealthCheck,
+		RestartPolicy:  t.RestartPolicy,
+		Labels:         t.Labels,
+		NodeSelector:   t.NodeSelector,
+		Affinity:       t.Affinity,
+		TopologySpread: t.TopologySpread,
+		Tolerations:    t.Tolerations,
+		Scheduler:      t.Scheduler,
+		PriorityClass:  t.PriorityClass,
+	}
+}
+
+func formatPorts(s ServiceSpec) string {
+	var ports []string
+	for p := range s.ExposedPorts {
+		if hostPort, ok := s.PortBindings[string(p)]; ok {
+			ports = append(ports, fmt.Sprintf("%s:%s", hostPort, p))
+			continue
+		}
+		ports = append(ports, string(p))
+	}
+	sort.Strings(ports)
+	return strings.Join(ports, ",")
+}
+
+// formatJSON renders nested placement settings for diffs.
+func formatJSON(v interface{}) string {
+	if v == nil || reflect.ValueOf(v).IsNil() {
+		return ""
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func diffSpecs(current ServiceSpec, desired ServiceSpec) []FieldChange {
+	var changes []FieldChange
+	add := func(field string, c, d interface{}) {
+		if !reflect.DeepEqual(c, d) {
+			changes = append(changes, FieldChange{Field: field, Current: fmt.Sprint(c), Desired: fmt.Sprint(d)})
+		}
+	}
+	add("image", current.Image, desired.Image)
+	add("cpu", current.Cpu, desired.Cpu)
+	add("memory", current.Memory, desired.Memory)
+	add("disk", current.Disk, desired.Disk)
+	add("ports", formatPorts(current), formatPorts(desired))
+	add("healthCheck", current.HealthCheck, desired.HealthCheck)
+	add("restartPolicy", current.RestartPolicy, desired.RestartPolicy)
+	add("labels", current.Labels, desired.Labels)
+	add("nodeSelector", current.NodeSelector, desired.NodeSelector)
+	add("affinity", formatJSON(current.Affinity), formatJSON(desired.Affinity))
+	add("topologySpread", formatJSON(current.TopologySpread), formatJSON(desired.TopologySpread))
+	add("tolerations", formatJSON(current.Tolerations), formatJSON(desired.Tolerations))
+	add("scheduler", current.Scheduler, desired.Scheduler)
+	add("priorityClass", current.PriorityClass, desired.PriorityClass)
+	return changes
+}
+
+// activeTaskByName returns the active standalone task with the given name
+// in a namespace.
+func (m *Manager) activeTaskByName(namespace, name string) *task.Task {
+	for _, t := range m.GetTasks() {
+		if t.Name == name && t.Service == "" && t.InNamespace(namespace) && isActive(t) {
+			return t
+		}
+	}
+	return nil
+}
+
+func (m *Manager) diffResource(namespace string, r spec.Resource) (ResourceDiff, error) {
+	diff := ResourceDiff{Kind: r.Kind, Name: r.Name, Action: ActionUnchanged}
+	template, err := r.Task()
+	if err != nil {
+		return diff, err
+	}
+	_, err = m.schedulerFor(template)
+	if err != nil {
+		return diff, fmt.Errorf("%s %s: %v", r.Kind, r.Name, err)
+	}
+	desired := serviceSpecFromTask(template)
+
+	switch r.Kind {
+	case spec.KindTask:
+		t := m.activeTaskByName(namespace, r.Name)
+		if t == nil {
+			diff.Action = ActionCreate
+			return diff, nil
+		}
+		diff.Changes = diffSpecs(serviceSpecFromTask(*t), desired)
+	case spec.KindService:
+		s, err := m.GetService(namespace, r.Name)
+		if err != nil {
+			diff.Action = ActionCreate
+			return diff, nil
+		}
+		m.serviceMu.Lock()
+		diff.Changes = diffSpecs(s.Spec, desired)
+		if s.Replicas != r.ReplicaCount() {
+			diff.Changes = append(diff.Changes, FieldChange{Field: "replicas", Current: fmt.Sprint(s.Replicas), Desired: fmt.Sprint(r.ReplicaCount())})
+		}
+		m.serviceMu.Unlock()
+	}
+	if len(diff.Changes) > 0 {
+		diff.Action = ActionUpdate
+	}
+	return diff, nil
+}
+
+// Diff compares the resources to the current state of a namespace without
+// changing it.
+func (m *Manager) Diff(namespace string, resources []spec.Resource) ([]ResourceDiff, error) {
+	var diffs []ResourceDiff
+	for _, r := range resources {
+		d, err := m.diffResource(namespace, r)
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, d)
+	}
+	return diffs, nil
+}
+
+func (m *Manager) startNamedTask(template task.Task) error {
+	t := template
+	t.ID = uuid.New()
+	t.State = task.Scheduled
+	err := m.admitTask(&t)
+	if err != nil {
+		return err
+	}
+	te := task.TaskEvent{
+		ID:        uuid.New(),
+		State:     task.Running,
+		Timestamp: time.Now(),
+		Task:      t,
+	}
+	m.AddTask(te)
+	log.Printf("[apply] created task %s for %s", t.ID, t.Name)
+	return nil
+}
+
+// Apply creates or updates the resources in a namespace so the current
+// state matches them. Tasks are immutable, so a changed task is replaced by
+// a new one.
+func (m *Manager) Apply(namespace string, resources []spec.Resource) ([]ResourceDiff, error) {
+	diffs, err := m.Diff(namespace, resources)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, r := range resources {
+		d := diffs[i]
+		if d.Action == ActionUnchanged {
+			continue
+		}
+		template, _ := r.Task()
+		template.Namespace = namespace
+
+		switch r.Kind {
+		case spec.KindTask:
+			if d.Action == ActionUpdate {
+				err = m.terminateTask(m.activeTaskByName(namespace, r.Name))
+				if err != nil {
+					return diffs, fmt.Errorf("unable to replace task %s: %v", r.Name, err)
+				}
+			}
+			err = m.startNamedTask(template)
+			if err != nil {
+				return diffs, err
+			}
+		case spec.KindService:
+			desired := serviceSpecFromTask(template)
+			if d.Action == ActionCreate {
+				err = m.AddService(&Service{Name: r.Name, Namespace: namespace, Replicas: r.ReplicaCount(), Spec: desired})
+				if err != nil {
+					return diffs, err
+				}
+				continue
+			}
+			for _, c := range d.Changes {
+				if c.Field != "replicas" {
+					_, err = m.UpdateService(namespace, r.Name, desired, nil, nil)
+					if err != nil {
+						return diffs, err
+					}
+					break
+				}
+			}
+			err = m.ScaleService(namespace, r.Name, r.ReplicaCount())
+			if err != nil {
+				return diffs, err
+			}
+		}
+		log.Printf("[apply] %s %s %s", d.Action, r.Kind, r.Name)
+	}
+	return diffs, nil
+}
+
+// DeleteResource removes the named task or service from a namespace.
+func (m *Manager) DeleteResource(namespace, kind, name string) error {
+	switch strings.ToLower(kind) {
+	case "task":
+		t := m.activeTaskByName(namespace, name)
+		if t == nil {
+			return fmt.Errorf("task %s not found", name)
+		}
+		return m.terminateTask(t)
+	case "service":
+		return m.RemoveService(namespace, name)
+	}
+	return fmt.Errorf("unknown kind %q", kind)
+}
@@ -0,0 +1,293 @@
+package manager
+
+import (
+	"cube/task"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+)
+
+const (
+	// utilization within this ratio of the target does not trigger scaling
+	autoscaleTolerance = 0.1
+	maxServiceEvents   = 50
+)
+
+type AutoscaleConfig struct {
+	MinReplicas                   int
+	MaxReplicas                   int
+	TargetCpuPercent              float64
+	TargetMemoryPercent           float64
+	ScaleUpStabilizationSeconds   int
+	ScaleDownStabilizationSeconds int
+	CooldownSeconds               int
+}
+
+func (a *AutoscaleConfig) validate() error {
+	if a.MinReplicas < 0 || a.MaxReplicas < a.MinReplicas || a.MaxReplicas == 0 {
+		return errors.New("autoscaling needs 0 <= MinReplicas <= MaxReplicas and MaxReplicas > 0")
+	}
+	if a.TargetCpuPercent <= 0 && a.TargetMemoryPercent <= 0 {
+		return errors.New("autoscaling needs a CPU or memory utilization target")
+	}
+	if a.TargetCpuPercent < 0 || a.TargetMemoryPercent < 0 || a.ScaleUpStabilizationSeconds < 0 || a.ScaleDownStabilizationSeconds < 0 || a.CooldownSeconds < 0 {
+		return errors.New("autoscaling settings must not be negative")
+	}
+	return nil
+}
+
+type ServiceEvent struct {
+	Time    time.Time
+	Type    string
+	Message string
+}
+
+type recommendation struct {
+	time     time.Time
+	replicas int
+}
+
+func (s *Service) recordEvent(eventType string, msg string) {
+	s.Events = append(s.Events, ServiceEvent{Time: time.Now().UTC(), Type: eventType, Message: msg})
+	if len(s.Events) > maxServiceEvents {
+		s.Events = s.Events[len(s.Events)-maxServiceEvents:]
+	}
+}
+
+func (m *Manager) getTaskStats(worker string, t *task.Task) (*task.ContainerStats, error) {
+	url := fmt.Sprintf("http://%s/tasks/%s/stats", worker, t.ID)
+	resp, err := pollClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("worker %s returned %d for task %s stats", worker, resp.StatusCode, t.ID)
+	}
+
+	var cs task.ContainerStats
+	err = json.NewDecoder(resp.Body).Decode(&cs)
+	if err != nil {
+		return nil, err
+	}
+	return &cs, nil
+}
+
+// taskUtilization returns the CPU and memory utilization of a task in
+// percent of its requests. Tasks without requests are measured against the
+// capacity of the node they run on.
+func (m *Manager) taskUtilization(t *task.Task) (cpu float64, mem float64, err error) {
+	w, ok := m.workerFor(t.ID)
+	if !ok {
+		return 0, 0, fmt.Errorf("task %s is not assigned to a worker", t.ID)
+	}
+	cs, err := m.getTaskStats(w, t)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if t.Cpu > 0 {
+		cpu = cs.CpuCores / t.Cpu * 100
+	} else if cs.OnlineCpus > 0 {
+		cpu = cs.CpuCores / float64(cs.OnlineCpus) * 100
+	}
+
+	if t.Memory > 0 {
+		mem = float64(cs.MemoryUsage) / float64(t.Memory) * 100
+	} else if n := m.workerNode(w); n != nil {
+		if _, err := n.GetStats(); err == nil && n.Memory > 0 {
+			mem = float64(cs.MemoryUsage) / float64(n.Memory*1024) * 100
+		}
+	}
+	return cpu, mem, nil
+}
+
+// desiredReplicas computes the replica count that brings the average
+// utilization of the running tasks back to the target. Scaling starts from
+// the configured replica count so replicas that are not running yet are not
+// added a second time.
+func (m *Manager) desiredReplicas(s *Service) (int, string, error) {
+	a := s.Autoscale
+	var running []*task.Task
+	for _, t := range m.serviceTasks(s) {
+		if t.State == task.Running {
+			running = append(running, t)
+		}
+	}
+	if len(running) == 0 {
+		return s.Replicas, "", errors.New("no running tasks to measure")
+	}
+
+	var cpuTotal, memTotal float64
+	measured := 0
+	for _, t := range running {
+		cpu, mem, err := m.taskUtilization(t)
+		if err != nil {
+			log.Printf("[autoscaler] unable to get utilization of task %s: %v", t.ID, err)
+			continue
+		}
+		cpuTotal += cpu
+		memTotal += mem
+		measured++
+	}
+	if measured == 0 {
+		return s.Replicas, "", errors.New("no task metrics available")
+	}
+
+	desired := 0
+	reason := ""
+	scale := func(resource string, usage float64, target float64) {
+		if target <= 0 {
+			return
+		}
+		ratio := usage / target
+		n := s.Replicas
+		if math.Abs(ratio-1) > autoscaleTolerance {
+			n = int(math.Ceil(float64(s.Replicas) * ratio))
+		}
+		if n > desired {
+			desired = n
+			reason = fmt.Sprintf("%s utilization %.1f%% (target %.1f%%)", resource, usage, target)
+		}
+	}
+	scale("cpu", cpuTotal/float64(measured), a.TargetCpuPercent)
+	scale("memory", memTotal/float64(measured), a.TargetMemoryPercent)
+
+	if desired < a.MinReplicas {
+		desired = a.MinReplicas
+	}
+	if desired > a.MaxReplicas {
+		desired = a.MaxReplicas
+	}
+	return desired, reason, nil
+}
+
+// stabilize records the recommendation and returns the replica count to
+// apply: scaling up uses the lowest and scaling down the highest
+// recommendation seen within the respective window so short spikes and dips
+// do not cause flapping.
+func (s *Service) stabilize(desired int, now time.Time) int {
+	a := s.Autoscale
+	s.recommendations = append(s.recommendations, recommendation{time: now, replicas: desired})
+
+	up := time.Duration(a.ScaleUpStabilizationSeconds) * time.Second
+	down := time.Duration(a.ScaleDownStabilizationSeconds) * time.Second
+	window := up
+	if down > window {
+		window = down
+	}
+
+	upMin, downMax := desired, desired
+	var kept []recommendation
+	for _, r := range s.recommendations {
+		age := now.Sub(r.time)
+		if age > window {
+			continue
+		}
+		kept = append(kept, r)
+		if age <= up && r.replicas < upMin {
+			upMin = r.replicas
+		}
+		if age <= down && r.replicas > downMax {
+			downMax = r.replicas
+		}
+	}
+	s.recommendations = kept
+
+	switch {
+	case desired > s.Replicas:
+		if upMin < s.Replicas {
+			return s.Replicas
+		}
+		return upMin
+	case desired < s.Replicas:
+		if downMax > s.Replicas {
+			return s.Replicas
+		}
+		return downMax
+	}
+	return s.Replicas
+}
+
+func (m *Manager) autoscaleService(s *Service) {
+	desired, reason, err := m.desiredReplicas(s)
+	if err != nil {
+		log.Printf("[autoscaler] skipping service %s: %v", s.Name, err)
+		return
+	}
+
+	m.serviceMu.Lock()
+	defer m.serviceMu.Unlock()
+	if _, ok := m.Services[s.key()]; !ok || s.Autoscale == nil {
+		return
+	}
+	if s.Rollout != nil && s.Rollout.State != RolloutCompleted {
+		log.Printf("[autoscaler] service %s has a deployment in progress, not scaling", s.Name)
+		return
+	}
+
+	now := time.Now().UTC()
+	replicas := s.stabilize(desired, now)
+	if replicas == s.Replicas {
+		return
+	}
+	cooldown := time.Duration(s.Autoscale.CooldownSeconds) * time.Second
+	if now.Sub(s.LastScaleTime) < cooldown {
+		log.Printf("[autoscaler] service %s is cooling down, not scaling to %d", s.Name, replicas)
+		return
+	}
+
+	eventType := "ScaledUp"
+	if replicas < s.Replicas {
+		eventType = "ScaledDown"
+	}
+	msg := fmt.Sprintf("scaled from %d to %d replicas: %s", s.Replicas, replicas, reason)
+	log.Printf("[autoscaler] service %s %s", s.Name, msg)
+	s.recordEvent(eventType, msg)
+	s.Replicas = replicas
+	s.LastScaleTime = now
+}
+
+// SetAutoscale enables autoscaling of the service with the given settings,
+// or disables it when a is nil.
+func (m *Manager) SetAutoscale(namespace, name string, a *AutoscaleConfig) (*Service, error) {
+	if a != nil {
+		err := a.validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	m.serviceMu.Lock()
+	defer m.serviceMu.Unlock()
+	s, ok := m.Services[serviceKey(namespace, name)]
+	if !ok {
+		return nil, fmt.Errorf("service %s not found", name)
+	}
+	s.Autoscale = a
+	s.recommendations = nil
+	return s, nil
+}
+
+func (m *Manager) autoscaleServices() {
+	for _, s := range m.allServices() {
+		if s.Autoscale != nil {
+			m.autoscaleService(s)
+		}
+	}
+}
+
+func (m *Manager) AutoscaleServices() {
+	for {
+		log.Println("Evaluating service autoscalers")
+		m.autoscaleServices()
+		log.Println("Autoscaler evaluation completed")
+		d := m.intervals().Autoscale.Duration
+		log.Printf("Sleeping for %v", d)
+		time.Sleep(d)
+	}
+}
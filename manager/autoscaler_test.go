@@ -0,0 +1,51 @@
+package manager
+
+import (
+	"cube/task"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestDesiredReplicasWithPendingReplicas(t *testing.T) {
+	tests := []struct {
+		name     string
+		cpuCores float64
+		want     int
+	}{
+		{"within tolerance", 0.52, 4},
+		{"over the target", 1, 8},
+		{"under the target", 0.25, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			worker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(task.ContainerStats{CpuCores: tt.cpuCores})
+			}))
+			defer worker.Close()
+
+			m := newTestManager(t)
+			s := &Service{Name: "web", Namespace: task.DefaultNamespace, Replicas: 4, Autoscale: &AutoscaleConfig{MinReplicas: 1, MaxReplicas: 10, TargetCpuPercent: 50}}
+			// two replicas run, two are still waiting for a worker
+			for _, state := range []task.State{task.Running, task.Running, task.Pending, task.Pending} {
+				tk := &task.Task{ID: uuid.New(), Service: "web", State: state, Cpu: 1}
+				m.TaskDb.Put(tk.Key(), tk)
+				if state == task.Running {
+					m.assignTask(strings.TrimPrefix(worker.URL, "http://"), tk.ID)
+				}
+			}
+
+			got, _, err := m.desiredReplicas(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("desiredReplicas() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
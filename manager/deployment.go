@@ -0,0 +1,247 @@
+package manager
+
+import (
+	"cube/task"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	StrategyRolling   = "rolling"
+	StrategyCanary    = "canary"
+	StrategyBlueGreen = "bluegreen"
+)
+
+type CanaryConfig struct {
+	Replicas        int
+	Percent         int
+	AnalysisSeconds int
+	AutoPromote     bool
+}
+
+type BlueGreenConfig struct {
+	PreviewSeconds int
+	AutoPromote    bool
+}
+
+type DeployStrategy struct {
+	Type      string
+	Canary    CanaryConfig
+	BlueGreen BlueGreenConfig
+}
+
+func (d *DeployStrategy) validate() error {
+	if d.Type == "" {
+		d.Type = StrategyRolling
+	}
+	switch d.Type {
+	case StrategyRolling:
+	case StrategyCanary:
+		c := d.Canary
+		if c.Replicas < 0 || c.Percent < 0 || c.Percent > 100 || c.AnalysisSeconds < 0 {
+			return errors.New("invalid canary settings")
+		}
+		if c.Replicas == 0 && c.Percent == 0 {
+			return errors.New("canary needs a number or a percentage of replicas")
+		}
+	case StrategyBlueGreen:
+		if d.BlueGreen.PreviewSeconds < 0 {
+			return errors.New("invalid blue-green settings")
+		}
+	default:
+		return fmt.Errorf("unknown deployment strategy %s", d.Type)
+	}
+	return nil
+}
+
+// canaryReplicas returns how many replicas run the new revision while the
+// canary is being analyzed. At least one and at most all replicas are used.
+func (s *Service) canaryReplicas() int {
+	c := s.Strategy.Canary
+	n := c.Replicas
+	if n == 0 {
+		n = (s.Replicas*c.Percent + 99) / 100
+	}
+	if n < 1 {
+		n = 1
+	}
+	if n > s.Replicas {
+		n = s.Replicas
+	}
+	return n
+}
+
+// splitRevision separates the active tasks of a service into tasks of older
+// revisions and tasks of the current revision, along with the ones of the
+// latter that are ready.
+func (m *Manager) splitRevision(s *Service, active []*task.Task, monitor time.Duration) (old, fresh, ready []*task.Task) {
+	for _, t := range active {
+		if t.Revision != s.Revision {
+			old = append(old, t)
+			continue
+		}
+		fresh = append(fresh, t)
+		if m.taskReady(t, monitor) {
+			ready = append(ready, t)
+		}
+	}
+	return old, fresh, ready
+}
+
+// abortDeployment returns the service to the revision it was running before
+// the canary or blue-green deployment started. An aborted blue-green
+// deployment keeps only the blue set serving while the rejected green set
+// is stopped.
+func (m *Manager) abortDeployment(s *Service, reason string) {
+	s.Rollout.Message = reason
+	log.Printf("[deploy] aborting deployment of service %s: %s", s.Name, reason)
+	preview := s.Rollout.State == RolloutPreview
+	blue := s.Rollout.FromRevision
+	err := m.rollbackService(s, blue)
+	if err != nil {
+		log.Printf("[deploy] error aborting deployment of service %s: %v", s.Name, err)
+		return
+	}
+	if preview {
+		s.ActiveRevision = blue
+	}
+}
+
+func (m *Manager) canaryService(s *Service, tasks []*task.Task, active []*task.Task) {
+	r := s.Rollout
+	if t := m.rolloutFailed(s, tasks); t != nil {
+		m.abortDeployment(s, fmt.Sprintf("canary task %s failed", t.ID))
+		return
+	}
+
+	canaries := s.canaryReplicas()
+	analysis := time.Duration(s.Strategy.Canary.AnalysisSeconds) * time.Second
+	old, fresh, ready := m.splitRevision(s, active, analysis)
+
+	for i := len(fresh); i < canaries; i++ {
+		r.Tasks = append(r.Tasks, m.startServiceTask(s, s.current()))
+	}
+
+	stable, ok := s.revision(r.FromRevision)
+	if !ok {
+		stable = s.current()
+	}
+	for i := len(old); i < s.Replicas-canaries; i++ {
+		m.startServiceTask(s, stable)
+	}
+
+	// old tasks make room for canaries only once these are ready, so the
+	// service never drops below its replica count
+	keep := s.Replicas - len(ready)
+	if keep < s.Replicas-canaries {
+		keep = s.Replicas - canaries
+	}
+	if len(old) > keep {
+		m.stopServiceTasks(s, old, len(old)-keep)
+	}
+
+	if len(ready) < canaries {
+		return
+	}
+	r.Message = fmt.Sprintf("%d canary task(s) healthy for %v", len(ready), analysis)
+	if s.Strategy.Canary.AutoPromote {
+		m.promoteService(s)
+	}
+}
+
+func (m *Manager) blueGreenService(s *Service, tasks []*task.Task, active []*task.Task) {
+	r := s.Rollout
+	if t := m.rolloutFailed(s, tasks); t != nil {
+		m.abortDeployment(s, fmt.Sprintf("green task %s failed", t.ID))
+		return
+	}
+
+	preview := time.Duration(s.Strategy.BlueGreen.PreviewSeconds) * time.Second
+	old, fresh, ready := m.splitRevision(s, active, preview)
+
+	for i := len(fresh); i < s.Replicas; i++ {
+		r.Tasks = append(r.Tasks, m.startServiceTask(s, s.current()))
+	}
+	if blue, ok := s.revision(r.FromRevision); ok {
+		for i := len(old); i < s.Replicas; i++ {
+			m.startServiceTask(s, blue)
+		}
+	}
+
+	if len(ready) < s.Replicas {
+		return
+	}
+	r.Message = fmt.Sprintf("green set of %d task(s) ready", len(ready))
+	if s.Strategy.BlueGreen.AutoPromote {
+		m.promoteService(s)
+	}
+}
+
+// promoteService finishes a canary by rolling the remaining replicas over to
+// the new revision, or switches all traffic to the green set of a blue-green
+// deployment and stops the blue one.
+func (m *Manager) promoteService(s *Service) error {
+	r := s.Rollout
+	if r == nil {
+		return fmt.Errorf("service %s has no deployment in progress", s.Name)
+	}
+
+	switch r.State {
+	case RolloutCanary:
+		log.Printf("[deploy] promoting canary of service %s to all replicas", s.Name)
+		r.State = RolloutUpdating
+		r.Message = "canary promoted"
+	case RolloutPreview:
+		var ready int
+		var old []*task.Task
+		for _, t := range m.serviceTasks(s) {
+			if !isActive(t) {
+				continue
+			}
+			if t.Revision != s.Revision {
+				old = append(old, t)
+			} else if m.taskReady(t, 0) {
+				ready++
+			}
+		}
+		if ready < s.Replicas {
+			return fmt.Errorf("green set of service %s is not ready (%d/%d)", s.Name, ready, s.Replicas)
+		}
+
+		log.Printf("[deploy] switching service %s to revision %d", s.Name, s.Revision)
+		s.ActiveRevision = s.Revision
+		m.stopServiceTasks(s, old, len(old))
+		r.State = RolloutCompleted
+		r.FinishTime = time.Now().UTC()
+		r.Message = "switched to green set"
+	default:
+		return fmt.Errorf("service %s has no deployment awaiting promotion", s.Name)
+	}
+	return nil
+}
+
+func (m *Manager) PromoteService(namespace, name string) (*Service, error) {
+	m.serviceMu.Lock()
+	defer m.serviceMu.Unlock()
+	s, ok := m.Services[serviceKey(namespace, name)]
+	if !ok {
+		return nil, fmt.Errorf("service %s not found", name)
+	}
+	return s, m.promoteService(s)
+}
+
+func (m *Manager) AbortService(namespace, name string) (*Service, error) {
+	m.serviceMu.Lock()
+	defer m.serviceMu.Unlock()
+	s, ok := m.Services[serviceKey(namespace, name)]
+	if !ok {
+		return nil, fmt.Errorf("service %s not found", name)
+	}
+	if s.Rollout == nil || (s.Rollout.State != RolloutCanary && s.Rollout.State != RolloutPreview) {
+		return nil, fmt.Errorf("service %s has no canary or blue-green deployment in progress", s.Name)
+	}
+	m.abortDeployment(s, "aborted on request")
+	return s, nil
+}
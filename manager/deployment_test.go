@@ -0,0 +1,62 @@
+package manager
+
+import (
+	"cube/task"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestAbortBlueGreenKeepsGreenOutOfTraffic(t *testing.T) {
+	tests := []struct {
+		name  string
+		abort func(m *Manager, s *Service)
+	}{
+		{"aborted on request", func(m *Manager, s *Service) {
+			_, err := m.AbortService(s.Namespace, s.Name)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"green task failed", func(m *Manager, s *Service) {
+			failed := &task.Task{ID: uuid.New(), Service: s.Name, Revision: 2, State: task.Failed}
+			m.TaskDb.Put(failed.Key(), failed)
+			s.Rollout.Tasks = append(s.Rollout.Tasks, failed.ID)
+			m.serviceMu.Lock()
+			m.blueGreenService(s, m.serviceTasks(s), nil)
+			m.serviceMu.Unlock()
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(t)
+			s := &Service{Name: "web", Replicas: 2, Spec: ServiceSpec{Image: "web:1"}, Strategy: DeployStrategy{Type: StrategyBlueGreen}}
+			err := m.AddService(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = m.UpdateService("", "web", ServiceSpec{Image: "web:2"}, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var tasks []*task.Task
+			for _, revision := range []int{1, 1, 2, 2} {
+				tk := &task.Task{ID: uuid.New(), Service: "web", Revision: revision, State: task.Running}
+				m.TaskDb.Put(tk.Key(), tk)
+				tasks = append(tasks, tk)
+			}
+
+			tt.abort(m, s)
+
+			if s.Rollout.State != RollingBack {
+				t.Fatalf("rollout state = %v, want rolling back", s.Rollout.State)
+			}
+			for _, tk := range tasks {
+				if got, want := s.Serving(tk), tk.Revision == 1; got != want {
+					t.Errorf("task of revision %d serving = %v, want %v", tk.Revision, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package manager
+
+import (
+	"cube/discovery"
+	"cube/task"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func workerHost(worker string) string {
+	return strings.Split(worker, ":")[0]
+}
+
+// taskEndpoints returns one endpoint per published container port of a
+// running task.
+func (m *Manager) taskEndpoints(t *task.Task) []discovery.Endpoint {
+	w, ok := m.workerFor(t.ID)
+	if !ok {
+		return nil
+	}
+	var endpoints []discovery.Endpoint
+	for containerPort, bindings := range t.HostPorts {
+		if len(bindings) == 0 {
+			continue
+		}
+		port, err := strconv.Atoi(bindings[0].HostPort)
+		if err != nil {
+			continue
+		}
+		endpoints = append(endpoints, discovery.Endpoint{
+			TaskID:        t.ID,
+			TaskName:      discovery.Name(t.Namespace, t.Name),
+			Service:       discovery.Name(t.Namespace, t.Service),
+			Namespace:     task.NamespaceOf(t.Namespace),
+			Host:          workerHost(w),
+			Port:          port,
+			ContainerPort: string(containerPort),
+		})
+	}
+	return endpoints
+}
+
+// taskServing reports whether a task should be registered: it must be
+// running, pass its health check and, for service tasks, belong to a
+// revision that currently receives traffic.
+func (m *Manager) taskServing(t *task.Task) bool {
+	if t.State != task.Running || len(t.HostPorts) == 0 {
+		return false
+	}
+	if t.Service != "" {
+		s, err := m.GetService(t.Namespace, t.Service)
+		if err != nil {
+			return false
+		}
+		m.serviceMu.Lock()
+		serving := s.Serving(t)
+		m.serviceMu.Unlock()
+		if !serving {
+			return false
+		}
+	}
+	if t.HealthCheck != "" && m.checkTaskHealth(*t) != nil {
+		return false
+	}
+	return true
+}
+
+func (m *Manager) syncEndpoints() {
+	var endpoints []discovery.Endpoint
+	for _, t := range m.GetTasks() {
+		if m.taskServing(t) {
+			endpoints = append(endpoints, m.taskEndpoints(t)...)
+		}
+	}
+	m.Registry.Update(endpoints)
+}
+
+func (m *Manager) SyncEndpoints() {
+	for {
+		log.Println("Syncing service discovery endpoints")
+		m.syncEndpoints()
+		log.Println("Endpoint sync completed")
+		d := m.intervals().Endpoints.Duration
+		log.Printf("Sleeping for %v", d)
+		time.Sleep(d)
+	}
+}
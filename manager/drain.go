@@ -0,0 +1,266 @@
+package manager
+
+import (
+	"cube/task"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// DisruptionBudget limits how many tasks of a service may be unavailable
+// because of voluntary evictions such as drains. At least one task may
+// always be evicted, otherwise single replica services could never be
+// drained.
+type DisruptionBudget struct {
+	MaxUnavailable int
+}
+
+func (b *DisruptionBudget) validate() error {
+	if b.MaxUnavailable < 0 {
+		return errors.New("maxUnavailable must not be negative")
+	}
+	if b.MaxUnavailable == 0 {
+		b.MaxUnavailable = 1
+	}
+	return nil
+}
+
+type DrainState int
+
+const (
+	Draining DrainState = iota
+	Drained
+	DrainCancelled
+)
+
+func (s DrainState) String() string {
+	switch s {
+	case Draining:
+		return "Draining"
+	case Drained:
+		return "Drained"
+	}
+	return "Cancelled"
+}
+
+// Drain reports the progress of moving the tasks off a node. Blocked lists
+// why tasks could not be evicted during the last pass.
+type Drain struct {
+	Node       string
+	State      DrainState
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Total      int
+	Evicted    int
+	Remaining  int
+	Blocked    []string
+}
+
+func (m *Manager) SetDisruptionBudget(namespace, name string, b DisruptionBudget) (*Service, error) {
+	err := b.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	m.serviceMu.Lock()
+	defer m.serviceMu.Unlock()
+	s, ok := m.Services[serviceKey(namespace, name)]
+	if !ok {
+		return nil, fmt.Errorf("service %s not found", name)
+	}
+	s.Disruption = b
+	return s, nil
+}
+
+func (m *Manager) setUnschedulable(name string, unschedulable bool) error {
+	m.nodeMu.Lock()
+	defer m.nodeMu.Unlock()
+	for _, n := range m.WorkerNodes {
+		if n.Name == name {
+			n.Unschedulable = unschedulable
+			return nil
+		}
+	}
+	return fmt.Errorf("%w %s", ErrUnknownNode, name)
+}
+
+// Cordon stops new tasks from being scheduled on a node. Tasks already
+// running there are left alone.
+func (m *Manager) Cordon(name string) error {
+	err := m.setUnschedulable(name, true)
+	if err == nil {
+		log.Printf("[manager] cordoned node %s", name)
+	}
+	return err
+}
+
+// Uncordon makes a node schedulable again and cancels a drain in progress.
+func (m *Manager) Uncordon(name string) error {
+	err := m.setUnschedulable(name, false)
+	if err != nil {
+		return err
+	}
+	m.drainMu.Lock()
+	defer m.drainMu.Unlock()
+	if d, ok := m.Drains[name]; ok && d.State == Draining {
+		d.State = DrainCancelled
+		d.FinishedAt = time.Now().UTC()
+	}
+	log.Printf("[manager] uncordoned node %s", name)
+	return nil
+}
+
+// DrainNode cordons a node and starts moving its tasks to other nodes.
+// Progress is reported by GetDrain.
+func (m *Manager) DrainNode(name string) (Drain, error) {
+	err := m.Cordon(name)
+	if err != nil {
+		return Drain{}, err
+	}
+	m.drainMu.Lock()
+	defer m.drainMu.Unlock()
+	d, ok := m.Drains[name]
+	if !ok || d.State != Draining {
+		d = &Drain{Node: name, State: Draining, StartedAt: time.Now().UTC()}
+		m.Drains[name] = d
+		log.Printf("[manager] draining node %s", name)
+	}
+	return *d, nil
+}
+
+func (m *Manager) GetDrain(name string) (Drain, error) {
+	m.drainMu.Lock()
+	defer m.drainMu.Unlock()
+	d, ok := m.Drains[name]
+	if !ok {
+		return Drain{}, fmt.Errorf("node %s is not being drained", name)
+	}
+	return *d, nil
+}
+
+// nodeTasks returns the active tasks assigned to a worker.
+func (m *Manager) nodeTasks(worker string) []*task.Task {
+	var tasks []*task.Task
+	for _, t := range m.assignedTasks(worker) {
+		if t.State == task.Scheduled || t.State == task.Running {
+			tasks = append(tasks, t)
+		}
+	}
+	return tasks
+}
+
+// evictTask stops a task that is not part of a service and schedules it on
+// another node.
+func (m *Manager) evictTask(worker string, t *task.Task) error {
+	var target bool
+	for _, n := range m.readyNodes(*t) {
+		if n.Name != worker && !n.Unschedulable {
+			target = true
+		}
+	}
+	if !target {
+		return errors.New("no other node can run it")
+	}
+	err := m.stopTask(worker, t.ID.String())
+	if err != nil {
+		return err
+	}
+	m.loseTask(worker, t)
+	return nil
+}
+
+// evictServiceTasks stops as many of the given tasks of the service with
+// the given key as its disruption budget allows. The service reconciler
+// replaces them on other nodes.
+func (m *Manager) evictServiceTasks(key string, tasks []*task.Task) (int, string) {
+	m.serviceMu.Lock()
+	defer m.serviceMu.Unlock()
+	s, ok := m.Services[key]
+	if !ok {
+		return 0, ""
+	}
+
+	var available int
+	for _, t := range m.serviceTasks(s) {
+		if t.State == task.Running {
+			available++
+		}
+	}
+	allowed := available - (s.Replicas - s.Disruption.MaxUnavailable)
+	evicted := 0
+	for _, t := range tasks {
+		if evicted >= allowed {
+			return evicted, fmt.Sprintf("service %s: disruption budget allows no more evictions, %d of %d replicas available", s.Name, available-evicted, s.Replicas)
+		}
+		err := m.terminateTask(t)
+		if err != nil {
+			return evicted, fmt.Sprintf("service %s: error stopping task %s: %v", s.Name, t.ID, err)
+		}
+		s.recordEvent("Evicted", fmt.Sprintf("evicted task %s from draining node", t.ID))
+		evicted++
+	}
+	return evicted, ""
+}
+
+func (m *Manager) drainStep(d *Drain) {
+	tasks := m.nodeTasks(d.Node)
+	var blocked []string
+	evicted := 0
+
+	services := make(map[string][]*task.Task)
+	for _, t := range tasks {
+		if t.Service != "" {
+			if _, err := m.GetService(t.Namespace, t.Service); err == nil {
+				key := serviceKey(t.Namespace, t.Service)
+				services[key] = append(services[key], t)
+				continue
+			}
+		}
+		err := m.evictTask(d.Node, t)
+		if err != nil {
+			blocked = append(blocked, fmt.Sprintf("task %s: %v", t.ID, err))
+			continue
+		}
+		evicted++
+	}
+	for key, serviceTasks := range services {
+		n, reason := m.evictServiceTasks(key, serviceTasks)
+		evicted += n
+		if reason != "" {
+			blocked = append(blocked, reason)
+		}
+	}
+
+	m.drainMu.Lock()
+	defer m.drainMu.Unlock()
+	if d.State != Draining {
+		return
+	}
+	d.Evicted += evicted
+	d.Remaining = len(tasks) - evicted
+	if d.Total < d.Evicted+d.Remaining {
+		d.Total = d.Evicted + d.Remaining
+	}
+	d.Blocked = blocked
+	if d.Remaining == 0 {
+		d.State = Drained
+		d.FinishedAt = time.Now().UTC()
+		log.Printf("[manager] node %s drained, %d tasks evicted", d.Node, d.Evicted)
+	}
+}
+
+func (m *Manager) drainNodes() {
+	m.drainMu.Lock()
+	var drains []*Drain
+	for _, d := range m.Drains {
+		if d.State == Draining {
+			drains = append(drains, d)
+		}
+	}
+	m.drainMu.Unlock()
+
+	for _, d := range drains {
+		m.drainStep(d)
+	}
+}
@@ -0,0 +1,94 @@
+package manager
+
+import (
+	"cube/node"
+	"cube/scheduler"
+	"cube/spec"
+	"cube/task"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Placement is where a dry run would put one replica of a resource. Node
+// is empty if it could not be placed; Attempt explains why.
+type Placement struct {
+	Kind    string
+	Name    string
+	Replica int
+	Node    string
+	Attempt task.SchedulingAttempt
+}
+
+// readySnapshot returns copies of the ready nodes that a dry run can
+// reserve resources on without touching the real ones.
+func (m *Manager) readySnapshot() []*node.Node {
+	m.refreshNodeTasks()
+	m.nodeMu.RLock()
+	defer m.nodeMu.RUnlock()
+	var nodes []*node.Node
+	for _, n := range m.WorkerNodes {
+		if n.Status != node.Ready {
+			continue
+		}
+		c := *n
+		c.Tasks = append([]node.TaskRef(nil), n.Tasks...)
+		c.PortsAllocated = append([]string(nil), n.PortsAllocated...)
+		nodes = append(nodes, &c)
+	}
+	return nodes
+}
+
+// DryRun reports where the tasks of the resources would be placed in a
+// namespace, without scheduling anything. Each placed replica reserves its
+// requests on the snapshot so the following ones see it, as they would for
+// real, and counts against the quota of the namespace.
+func (m *Manager) DryRun(namespace string, resources []spec.Resource) ([]Placement, error) {
+	nodes := m.readySnapshot()
+	var placements []Placement
+	var planned []task.Task
+	for _, r := range resources {
+		t, err := r.Task()
+		if err != nil {
+			return nil, err
+		}
+		t.Namespace = task.NamespaceOf(namespace)
+		s, err := m.schedulerFor(t)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %v", r.Kind, r.Name, err)
+		}
+		// picking advances the round robin scheduler, so the dry run
+		// works on a copy
+		if rr, ok := s.(*scheduler.RoundRobin); ok {
+			c := *rr
+			s = &c
+		}
+		if r.Kind == spec.KindService {
+			t.Service = r.Name
+		}
+
+		for i := 0; i < r.ReplicaCount(); i++ {
+			t.ID = uuid.New()
+			m.quotaMu.Lock()
+			err := m.checkQuota(&t, planned)
+			m.quotaMu.Unlock()
+			if err != nil {
+				attempt := task.SchedulingAttempt{Time: time.Now().UTC(), Scheduler: m.schedulerName(t), Error: err.Error()}
+				placements = append(placements, Placement{Kind: r.Kind, Name: r.Name, Replica: i, Attempt: attempt})
+				continue
+			}
+			planned = append(planned, t)
+
+			selected, attempt := scheduler.Schedule(s, t, nodes)
+			attempt.Scheduler = m.schedulerName(t)
+			p := Placement{Kind: r.Kind, Name: r.Name, Replica: i, Attempt: attempt}
+			if selected != nil {
+				p.Node = selected.Name
+				scheduler.Reserve(selected, &t)
+			}
+			placements = append(placements, p)
+		}
+	}
+	return placements, nil
+}
@@ -0,0 +1,56 @@
+package manager
+
+import (
+	"cube/spec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDryRunNamespaceQuota(t *testing.T) {
+	resources, err := spec.Parse([]byte("kind: Service\nname: web\nspec:\n  image: web\n  replicas: 3\n  cpu: 500m\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		namespace string
+		quota     *Quota
+		rejected  []int
+	}{
+		{"no quota", "team-a", nil, nil},
+		{"task count", "team-a", &Quota{Tasks: 2}, []int{2}},
+		{"cpu", "team-a", &Quota{Cpu: 0.5}, []int{1, 2}},
+		{"max per task", "team-a", &Quota{Limits: LimitRange{Max: Resources{Cpu: 0.25}}}, []int{0, 1, 2}},
+		{"quota of another namespace", "default", &Quota{Tasks: 1}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(t)
+			registerWorker(t, m, "worker-1:5555")
+			if tt.quota != nil {
+				_, err := m.SetQuota("team-a", tt.quota)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			placements, err := m.DryRun(tt.namespace, resources)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var rejected []int
+			for _, p := range placements {
+				if p.Node == "" {
+					if !strings.Contains(p.Attempt.Error, "namespace team-a") {
+						t.Errorf("replica %d rejected with %q", p.Replica, p.Attempt.Error)
+					}
+					rejected = append(rejected, p.Replica)
+				}
+			}
+			if len(placements) != 3 || !reflect.DeepEqual(rejected, tt.rejected) {
+				t.Errorf("rejected replicas %v of %d, want %v of 3", rejected, len(placements), tt.rejected)
+			}
+		})
+	}
+}
@@ -1,9 +1,14 @@
 package manager
 
 import (
+	"cube/node"
+	"cube/proxy"
+	"cube/spec"
 	"cube/task"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"time"
@@ -33,6 +38,30 @@ func (a *Api) StartTaskHandler(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(e)
 		return
 	}
+	te.Task.Namespace = namespaceParam(r)
+	err = te.Task.ValidatePlacement()
+	if err != nil {
+		writeError(w, 400, fmt.Sprintf("Invalid placement: %v\n", err))
+		return
+	}
+	_, err = a.Manager.schedulerFor(te.Task)
+	if err != nil {
+		writeError(w, 400, fmt.Sprintf("Invalid task: %v\n", err))
+		return
+	}
+	err = a.Manager.admitTask(&te.Task)
+	if errors.Is(err, ErrQuotaExceeded) {
+		writeError(w, 403, fmt.Sprintf("Task not admitted: %v\n", err))
+		return
+	}
+	if errors.Is(err, ErrTaskExists) {
+		writeError(w, 409, fmt.Sprintf("Task not admitted: %v\n", err))
+		return
+	}
+	if err != nil {
+		writeError(w, 400, fmt.Sprintf("Task not admitted: %v\n", err))
+		return
+	}
 	a.Manager.AddTask(te)
 	log.Printf("Added task %v\n", te.Task.ID)
 	w.WriteHeader(201)
@@ -42,7 +71,7 @@ func (a *Api) StartTaskHandler(w http.ResponseWriter, r *http.Request) {
 func (a *Api) GetTasksHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(200)
-	json.NewEncoder(w).Encode(a.Manager.GetTasks())
+	json.NewEncoder(w).Encode(a.Manager.namespaceTasks(namespaceParam(r)))
 }
 
 func (a *Api) StopTaskHandler(w http.ResponseWriter, r *http.Request) {
@@ -54,7 +83,7 @@ func (a *Api) StopTaskHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	tID, _ := uuid.Parse(taskID)
-	taskToStop, err := a.Manager.TaskDb.Get(tID.String())
+	taskToStop, err := a.Manager.TaskDb.Get(task.Key(namespaceParam(r), tID))
 	if err != nil {
 		log.Printf("No task with ID %v found", tID)
 		w.WriteHeader(404)
@@ -75,3 +104,684 @@ func (a *Api) StopTaskHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(204)
 
 }
+
+func (a *Api) StartWorkflowHandler(w http.ResponseWriter, r *http.Request) {
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+	wf := Workflow{}
+	err := d.Decode(&wf)
+	if err != nil {
+		msg := fmt.Sprintf("Error unmarshalling body: %v\n", err)
+		log.Printf("%v", msg)
+		w.WriteHeader(400)
+		e := ErrResponse{
+			HTTPStatusCode: 400,
+			Message:        msg,
+		}
+		json.NewEncoder(w).Encode(e)
+		return
+	}
+
+	wf.Namespace = namespaceParam(r)
+	err = a.Manager.AddWorkflow(&wf)
+	if err != nil {
+		msg := fmt.Sprintf("Invalid workflow: %v\n", err)
+		log.Printf("%v", msg)
+		w.WriteHeader(400)
+		e := ErrResponse{
+			HTTPStatusCode: 400,
+			Message:        msg,
+		}
+		json.NewEncoder(w).Encode(e)
+		return
+	}
+	log.Printf("Added workflow %v\n", wf.ID)
+	w.WriteHeader(201)
+	json.NewEncoder(w).Encode(wf)
+}
+
+func (a *Api) GetWorkflowsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(a.Manager.GetWorkflows(namespaceParam(r)))
+}
+
+func (a *Api) GetWorkflowHandler(w http.ResponseWriter, r *http.Request) {
+	workflowID := chi.URLParam(r, "workflowID")
+	wfID, err := uuid.Parse(workflowID)
+	if err != nil {
+		log.Printf("Invalid workflowID %v in request.\n", workflowID)
+		w.WriteHeader(400)
+		return
+	}
+
+	wf, err := a.Manager.GetWorkflow(namespaceParam(r), wfID)
+	if err != nil {
+		log.Printf("No workflow with ID %v found", wfID)
+		w.WriteHeader(404)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(wf)
+}
+
+// namespaceParam returns the namespace of a namespace-scoped route, or the
+// default namespace for the routes outside /namespaces.
+func namespaceParam(r *http.Request) string {
+	return task.NamespaceOf(chi.URLParam(r, "namespace"))
+}
+
+// validNamespace rejects requests for namespaces with invalid names.
+func validNamespace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := task.ValidateNamespace(chi.URLParam(r, "namespace"))
+		if err != nil {
+			writeError(w, 400, fmt.Sprintf("%v\n", err))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	log.Printf("%v", msg)
+	w.WriteHeader(code)
+	e := ErrResponse{
+		HTTPStatusCode: code,
+		Message:        msg,
+	}
+	json.NewEncoder(w).Encode(e)
+}
+
+func (a *Api) CreateServiceHandler(w http.ResponseWriter, r *http.Request) {
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+	s := Service{}
+	err := d.Decode(&s)
+	if err != nil {
+		writeError(w, 400, fmt.Sprintf("Error unmarshalling body: %v\n", err))
+		return
+	}
+
+	s.Namespace = namespaceParam(r)
+	err = a.Manager.AddService(&s)
+	if err != nil {
+		writeError(w, 400, fmt.Sprintf("Invalid service: %v\n", err))
+		return
+	}
+	log.Printf("Added service %v\n", s.Name)
+	w.WriteHeader(201)
+	json.NewEncoder(w).Encode(s)
+}
+
+func (a *Api) GetServicesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(a.Manager.GetServices(namespaceParam(r)))
+}
+
+func (a *Api) GetServiceHandler(w http.ResponseWriter, r *http.Request) {
+	namespace := namespaceParam(r)
+	name := chi.URLParam(r, "serviceName")
+	s, err := a.Manager.GetService(namespace, name)
+	if err != nil {
+		writeError(w, 404, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(s)
+}
+
+func (a *Api) DeleteServiceHandler(w http.ResponseWriter, r *http.Request) {
+	namespace := namespaceParam(r)
+	name := chi.URLParam(r, "serviceName")
+	err := a.Manager.RemoveService(namespace, name)
+	if err != nil {
+		writeError(w, 404, err.Error())
+		return
+	}
+	log.Printf("Removed service %v\n", name)
+	w.WriteHeader(204)
+}
+
+type ScaleRequest struct {
+	Replicas int
+}
+
+func (a *Api) ScaleServiceHandler(w http.ResponseWriter, r *http.Request) {
+	namespace := namespaceParam(r)
+	name := chi.URLParam(r, "serviceName")
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+	req := ScaleRequest{}
+	err := d.Decode(&req)
+	if err != nil {
+		writeError(w, 400, fmt.Sprintf("Error unmarshalling body: %v\n", err))
+		return
+	}
+
+	err = a.Manager.ScaleService(namespace, name, req.Replicas)
+	if err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
+	s, _ := a.Manager.GetService(namespace, name)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(s)
+}
+
+type UpdateServiceRequest struct {
+	Spec     ServiceSpec
+	Update   *UpdateConfig
+	Strategy *DeployStrategy
+}
+
+func (a *Api) UpdateServiceHandler(w http.ResponseWriter, r *http.Request) {
+	namespace := namespaceParam(r)
+	name := chi.URLParam(r, "serviceName")
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+	req := UpdateServiceRequest{}
+	err := d.Decode(&req)
+	if err != nil {
+		writeError(w, 400, fmt.Sprintf("Error unmarshalling body: %v\n", err))
+		return
+	}
+
+	s, err := a.Manager.UpdateService(namespace, name, req.Spec, req.Update, req.Strategy)
+	if err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
+	log.Printf("Updating service %v to revision %d\n", name, s.Revision)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(s)
+}
+
+func (a *Api) GetServiceRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	namespace := namespaceParam(r)
+	name := chi.URLParam(r, "serviceName")
+	s, err := a.Manager.GetService(namespace, name)
+	if err != nil {
+		writeError(w, 404, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(s.History)
+}
+
+type RollbackRequest struct {
+	Revision int
+}
+
+func (a *Api) RollbackServiceHandler(w http.ResponseWriter, r *http.Request) {
+	namespace := namespaceParam(r)
+	name := chi.URLParam(r, "serviceName")
+	req := RollbackRequest{}
+	if r.ContentLength != 0 {
+		d := json.NewDecoder(r.Body)
+		d.DisallowUnknownFields()
+		err := d.Decode(&req)
+		if err != nil {
+			writeError(w, 400, fmt.Sprintf("Error unmarshalling body: %v\n", err))
+			return
+		}
+	}
+
+	s, err := a.Manager.RollbackService(namespace, name, req.Revision)
+	if err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
+	log.Printf("Rolling back service %v to revision %d\n", name, s.Revision)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(s)
+}
+
+func (a *Api) ResumeServiceHandler(w http.ResponseWriter, r *http.Request) {
+	namespace := namespaceParam(r)
+	name := chi.URLParam(r, "serviceName")
+	s, err := a.Manager.ResumeService(namespace, name)
+	if err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(s)
+}
+
+func (a *Api) PromoteServiceHandler(w http.ResponseWriter, r *http.Request) {
+	namespace := namespaceParam(r)
+	name := chi.URLParam(r, "serviceName")
+	s, err := a.Manager.PromoteService(namespace, name)
+	if err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(s)
+}
+
+func (a *Api) AbortServiceHandler(w http.ResponseWriter, r *http.Request) {
+	namespace := namespaceParam(r)
+	name := chi.URLParam(r, "serviceName")
+	s, err := a.Manager.AbortService(namespace, name)
+	if err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(s)
+}
+
+func (a *Api) AutoscaleServiceHandler(w http.ResponseWriter, r *http.Request) {
+	namespace := namespaceParam(r)
+	name := chi.URLParam(r, "serviceName")
+	var cfg *AutoscaleConfig
+	if r.Method == http.MethodPut {
+		cfg = &AutoscaleConfig{}
+		d := json.NewDecoder(r.Body)
+		d.DisallowUnknownFields()
+		err := d.Decode(cfg)
+		if err != nil {
+			writeError(w, 400, fmt.Sprintf("Error unmarshalling body: %v\n", err))
+			return
+		}
+	}
+
+	s, err := a.Manager.SetAutoscale(namespace, name, cfg)
+	if err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(s)
+}
+
+func (a *Api) DisruptionBudgetHandler(w http.ResponseWriter, r *http.Request) {
+	namespace := namespaceParam(r)
+	name := chi.URLParam(r, "serviceName")
+	b := DisruptionBudget{}
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+	err := d.Decode(&b)
+	if err != nil {
+		writeError(w, 400, fmt.Sprintf("Error unmarshalling body: %v\n", err))
+		return
+	}
+
+	s, err := a.Manager.SetDisruptionBudget(namespace, name, b)
+	if err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(s)
+}
+
+func (a *Api) GetQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(a.Manager.GetQuota(namespaceParam(r)))
+}
+
+func (a *Api) SetQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	var q *Quota
+	if r.Method == http.MethodPut {
+		q = &Quota{}
+		d := json.NewDecoder(r.Body)
+		d.DisallowUnknownFields()
+		err := d.Decode(q)
+		if err != nil {
+			writeError(w, 400, fmt.Sprintf("Error unmarshalling body: %v\n", err))
+			return
+		}
+	}
+
+	status, err := a.Manager.SetQuota(namespaceParam(r), q)
+	if err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(status)
+}
+
+func (a *Api) GetDiscoveryNamesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(a.Manager.Registry.Names(namespaceParam(r)))
+}
+
+func (a *Api) LookupHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	endpoints := a.Manager.Registry.LookupIn(namespaceParam(r), name)
+	if len(endpoints) == 0 {
+		writeError(w, 404, fmt.Sprintf("No ready endpoints for %s\n", name))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(endpoints)
+}
+
+func (a *Api) SetIngressHandler(w http.ResponseWriter, r *http.Request) {
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+	rule := proxy.Rule{}
+	err := d.Decode(&rule)
+	if err != nil {
+		writeError(w, 400, fmt.Sprintf("Error unmarshalling body: %v\n", err))
+		return
+	}
+	rule.Namespace = namespaceParam(r)
+
+	err = a.Manager.Ingress.SetRule(&rule)
+	if err != nil {
+		writeError(w, 400, fmt.Sprintf("Invalid ingress rule: %v\n", err))
+		return
+	}
+	log.Printf("Set ingress rule %v\n", rule.Name)
+	w.WriteHeader(201)
+	json.NewEncoder(w).Encode(rule)
+}
+
+func (a *Api) GetIngressesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(a.Manager.Ingress.Rules(namespaceParam(r)))
+}
+
+func (a *Api) DeleteIngressHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	err := a.Manager.Ingress.DeleteRule(namespaceParam(r), name)
+	if err != nil {
+		writeError(w, 404, err.Error())
+		return
+	}
+	log.Printf("Deleted ingress rule %v\n", name)
+	w.WriteHeader(204)
+}
+
+func (a *Api) AddLoadBalancerHandler(w http.ResponseWriter, r *http.Request) {
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+	l := proxy.Listener{}
+	err := d.Decode(&l)
+	if err != nil {
+		writeError(w, 400, fmt.Sprintf("Error unmarshalling body: %v\n", err))
+		return
+	}
+	l.Namespace = namespaceParam(r)
+
+	err = a.Manager.L4.AddListener(&l)
+	if err != nil {
+		writeError(w, 400, fmt.Sprintf("Unable to add load balancer: %v\n", err))
+		return
+	}
+	log.Printf("Added load balancer %v\n", l.Name)
+	w.WriteHeader(201)
+	json.NewEncoder(w).Encode(l)
+}
+
+func (a *Api) GetLoadBalancersHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(a.Manager.L4.Listeners(namespaceParam(r)))
+}
+
+func (a *Api) DeleteLoadBalancerHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	err := a.Manager.L4.RemoveListener(namespaceParam(r), name)
+	if err != nil {
+		writeError(w, 404, err.Error())
+		return
+	}
+	log.Printf("Removed load balancer %v\n", name)
+	w.WriteHeader(204)
+}
+
+func readSpec(w http.ResponseWriter, r *http.Request) ([]spec.Resource, bool) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, 400, fmt.Sprintf("Error reading body: %v\n", err))
+		return nil, false
+	}
+	resources, err := spec.Parse(body)
+	if err != nil {
+		writeError(w, 400, fmt.Sprintf("Invalid spec: %v\n", err))
+		return nil, false
+	}
+	return resources, true
+}
+
+func (a *Api) ApplyHandler(w http.ResponseWriter, r *http.Request) {
+	resources, ok := readSpec(w, r)
+	if !ok {
+		return
+	}
+	diffs, err := a.Manager.Apply(namespaceParam(r), resources)
+	if err != nil {
+		writeError(w, 400, fmt.Sprintf("Error applying spec: %v\n", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(diffs)
+}
+
+func (a *Api) DiffHandler(w http.ResponseWriter, r *http.Request) {
+	resources, ok := readSpec(w, r)
+	if !ok {
+		return
+	}
+	diffs, err := a.Manager.Diff(namespaceParam(r), resources)
+	if err != nil {
+		writeError(w, 400, fmt.Sprintf("Error comparing spec: %v\n", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(diffs)
+}
+
+func (a *Api) DryRunHandler(w http.ResponseWriter, r *http.Request) {
+	resources, ok := readSpec(w, r)
+	if !ok {
+		return
+	}
+	placements, err := a.Manager.DryRun(namespaceParam(r), resources)
+	if err != nil {
+		writeError(w, 400, fmt.Sprintf("Error scheduling spec: %v\n", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(placements)
+}
+
+func (a *Api) DeleteResourceHandler(w http.ResponseWriter, r *http.Request) {
+	kind := chi.URLParam(r, "kind")
+	name := chi.URLParam(r, "name")
+	err := a.Manager.DeleteResource(namespaceParam(r), kind, name)
+	if err != nil {
+		writeError(w, 404, err.Error())
+		return
+	}
+	log.Printf("Deleted %v %v\n", kind, name)
+	w.WriteHeader(204)
+}
+
+func (a *Api) GetTaskLogsHandler(w http.ResponseWriter, r *http.Request) {
+	taskID := chi.URLParam(r, "taskID")
+	tID, _ := uuid.Parse(taskID)
+	_, err := a.Manager.TaskDb.Get(task.Key(namespaceParam(r), tID))
+	if err != nil {
+		writeError(w, 404, fmt.Sprintf("No task with ID %v found\n", tID))
+		return
+	}
+	worker, ok := a.Manager.workerFor(tID)
+	if !ok {
+		writeError(w, 404, fmt.Sprintf("Task %v is not assigned to a worker\n", tID))
+		return
+	}
+
+	url := fmt.Sprintf("http://%s/tasks/%s/logs?%s", worker, tID, r.URL.RawQuery)
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, url, nil)
+	if err != nil {
+		writeError(w, 500, fmt.Sprintf("Error creating request: %v\n", err))
+		return
+	}
+	resp, err := streamClient.Do(req)
+	if err != nil {
+		writeError(w, 502, fmt.Sprintf("Error connecting to %v: %v\n", worker, err))
+		return
+	}
+	defer resp.Body.Close()
+
+	w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+	w.WriteHeader(resp.StatusCode)
+	buf := make([]byte, 4096)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			w.Write(buf[:n])
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (a *Api) GetNodesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(a.Manager.nodes())
+}
+
+func (a *Api) RegisterNodeHandler(w http.ResponseWriter, r *http.Request) {
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+	reg := node.Registration{}
+	err := d.Decode(&reg)
+	if err != nil {
+		writeError(w, 400, fmt.Sprintf("Error unmarshalling body: %v\n", err))
+		return
+	}
+
+	n, err := a.Manager.Register(reg)
+	if err != nil {
+		writeError(w, 400, fmt.Sprintf("Invalid registration: %v\n", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(201)
+	json.NewEncoder(w).Encode(n)
+}
+
+func (a *Api) CordonNodeHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	err := a.Manager.Cordon(name)
+	if err != nil {
+		writeError(w, 404, err.Error())
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func (a *Api) UncordonNodeHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	err := a.Manager.Uncordon(name)
+	if err != nil {
+		writeError(w, 404, err.Error())
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func (a *Api) DrainNodeHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	d, err := a.Manager.DrainNode(name)
+	if err != nil {
+		writeError(w, 404, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(202)
+	json.NewEncoder(w).Encode(d)
+}
+
+func (a *Api) GetDrainHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	d, err := a.Manager.GetDrain(name)
+	if err != nil {
+		writeError(w, 404, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(d)
+}
+
+func (a *Api) HeartbeatHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	err := a.Manager.Heartbeat(name)
+	if err != nil {
+		writeError(w, 404, fmt.Sprintf("Node %v is not registered\n", name))
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func (a *Api) AddTaintHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+	taint := node.Taint{}
+	err := d.Decode(&taint)
+	if err != nil {
+		writeError(w, 400, fmt.Sprintf("Error unmarshalling body: %v\n", err))
+		return
+	}
+
+	n, err := a.Manager.AddTaint(name, taint)
+	if errors.Is(err, ErrUnknownNode) {
+		writeError(w, 404, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, 400, fmt.Sprintf("Invalid taint: %v\n", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(n)
+}
+
+func (a *Api) RemoveTaintHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	key := chi.URLParam(r, "key")
+	n, err := a.Manager.RemoveTaint(name, key, r.URL.Query().Get("effect"))
+	if err != nil {
+		writeError(w, 404, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(n)
+}
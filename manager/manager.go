@@ -2,7 +2,10 @@ package manager
 
 import (
 	"bytes"
+	"cube/config"
+	"cube/discovery"
 	"cube/node"
+	"cube/proxy"
 	"cube/scheduler"
 	"cube/store"
 	"cube/task"
@@ -12,25 +15,43 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"reflect"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/docker/go-connections/nat"
 	"github.com/go-chi/chi"
-	"github.com/golang-collections/collections/queue"
 	"github.com/google/uuid"
 )
 
 type Manager struct {
-	Pending       queue.Queue
+	Pending       PendingQueue
 	Workers       []string
 	WorkerTaskMap map[string][]uuid.UUID
 	TaskWorkerMap map[uuid.UUID]string
 	LastWorker    int
 	WorkerNodes   []*node.Node
+	nodeMu        sync.RWMutex
+	pollFailures  map[string]int
+	fenced        map[uuid.UUID]string
+	Drains        map[string]*Drain
+	drainMu       sync.Mutex
 	Scheduler     scheduler.Scheduler
+	schedulers    map[string]scheduler.Scheduler
 	TaskDb        store.Store
 	EventDb       store.Store
+	Workflows     map[uuid.UUID]*Workflow
+	workflowMu    sync.Mutex
+	Services      map[string]*Service
+	serviceMu     sync.Mutex
+	Quotas        map[string]*Quota
+	quotaMu       sync.Mutex
+	Registry      *discovery.Registry
+	Ingress       *proxy.HTTPProxy
+	L4            *proxy.L4Proxy
+	Config        config.Manager
+	configMu      sync.RWMutex
 }
 
 type Api struct {
@@ -40,30 +61,35 @@ type Api struct {
 	Router  *chi.Mux
 }
 
-func (m *Manager) SelectWorker(t task.Task) (*node.Node, error) {
-	candidates := m.Scheduler.SelectCandidateNodes(t, m.WorkerNodes)
-	if candidates == nil {
-		msg := fmt.Sprintf("No available candidates match resource request for task %v", t.ID)
-		err := errors.New(msg)
-		return nil, err
+// SelectWorker picks the node for a task and explains the decision.
+func (m *Manager) SelectWorker(t task.Task) (*node.Node, task.SchedulingAttempt, error) {
+	s, err := m.schedulerFor(t)
+	if err != nil {
+		return nil, task.SchedulingAttempt{Time: time.Now().UTC(), Scheduler: t.Scheduler, Error: err.Error()}, err
+	}
+	m.refreshNodeTasks()
+	selectedNode, attempt := scheduler.Schedule(s, t, m.readyNodes(t))
+	attempt.Scheduler = m.schedulerName(t)
+	if selectedNode == nil {
+		return nil, attempt, fmt.Errorf("%s for task %v", attempt.Error, t.ID)
 	}
-	scores := m.Scheduler.Score(t, candidates)
-	selectedNode := m.Scheduler.Pick(scores, candidates)
-	return selectedNode, nil
+	return selectedNode, attempt, nil
 }
 
 func (m *Manager) updateTasks() {
-	for _, worker := range m.Workers {
+	for _, worker := range m.workers() {
 		log.Printf("Checking worker %v for task updates", worker)
 		url := fmt.Sprintf("http://%s/tasks", worker)
-		resp, err := http.Get(url)
+		resp, err := pollClient.Get(url)
 		if err != nil {
 			log.Printf("Error connecting to %v: %v", worker, err)
+			m.pollFailed(worker)
 			continue
 		}
 
 		if resp.StatusCode != http.StatusOK {
 			log.Printf("Error sending request: %v", err)
+			m.pollFailed(worker)
 			continue
 		}
 
@@ -72,12 +98,17 @@ func (m *Manager) updateTasks() {
 		err = d.Decode(&tasks)
 		if err != nil {
 			log.Printf("Error unmarshalling tasks: %s", err.Error())
+			continue
 		}
+		m.markSeen(worker)
 
 		for _, t := range tasks {
 			log.Printf("Attempting to update task %v", t.ID)
+			if m.fence(worker, t) {
+				continue
+			}
 
-			result, err := m.TaskDb.Get(t.ID.String())
+			result, err := m.TaskDb.Get(t.Key())
 			if err != nil {
 				log.Printf("[manager] %s", err)
 				continue
@@ -88,7 +119,7 @@ func (m *Manager) updateTasks() {
 				continue
 			}
 
-			if taskPersisted.State != t.State {
+			if taskPersisted.State != t.State && task.ValidStateTransition(taskPersisted.State, t.State) {
 				taskPersisted.State = t.State
 			}
 
@@ -97,7 +128,7 @@ func (m *Manager) updateTasks() {
 			taskPersisted.ContainerID = t.ContainerID
 			taskPersisted.HostPorts = t.HostPorts
 
-			m.TaskDb.Put(taskPersisted.ID.String(), taskPersisted)
+			m.TaskDb.Put(taskPersisted.Key(), taskPersisted)
 		}
 	}
 }
@@ -107,24 +138,24 @@ func (m *Manager) UpdateTasks() {
 		log.Println("Checking for task updates from workers")
 		m.updateTasks()
 		log.Println("Task updates completed")
-		log.Println("Sleeping for 15 seconds")
-		time.Sleep(15 * time.Second)
+		d := m.intervals().UpdateTasks.Duration
+		log.Printf("Sleeping for %v", d)
+		time.Sleep(d)
 	}
 }
 
 func (m *Manager) SendWork() {
-	if m.Pending.Len() > 0 {
-		e := m.Pending.Dequeue()
+	if e := m.Pending.Dequeue(); e != nil {
 		te := e.(task.TaskEvent)
-		err := m.EventDb.Put(te.ID.String(), &te)
+		err := m.EventDb.Put(task.Key(te.Task.Namespace, te.ID), &te)
 		if err != nil {
 			log.Printf("error attempting to store task event %s: %s", te.ID.String(), err)
 		}
 		log.Printf("Pulled %v off pending queue", te)
 
-		taskWorker, ok := m.TaskWorkerMap[te.Task.ID]
+		taskWorker, ok := m.workerFor(te.Task.ID)
 		if ok {
-			result, err := m.TaskDb.Get(te.Task.ID.String())
+			result, err := m.TaskDb.Get(te.Task.Key())
 			if err != nil {
 				log.Printf("unable to schedule task: %s", err)
 				return
@@ -146,19 +177,81 @@ func (m *Manager) SendWork() {
 		}
 
 		t := te.Task
-		w, err := m.SelectWorker(t)
+		var lost bool
+		result, err := m.TaskDb.Get(t.Key())
+		if err == nil && te.State == task.Completed {
+			persisted := result.(*task.Task)
+			if persisted.State == task.Pending || persisted.State == task.Lost {
+				log.Printf("task %s was stopped before being scheduled", t.ID)
+				persisted.State = task.Completed
+				persisted.FinishTime = time.Now().UTC()
+				m.TaskDb.Put(persisted.Key(), persisted)
+			}
+			return
+		}
+		if err == nil {
+			switch result.(*task.Task).State {
+			case task.Completed:
+				log.Printf("task %s was stopped before being scheduled, dropping it", t.ID)
+				return
+			case task.Lost:
+				lost = true
+			}
+		}
+
+		w, attempt, err := m.SelectWorker(t)
+		if err != nil {
+			if worker, victims, ok := m.preempt(t); ok {
+				log.Printf("preempting %d tasks on node %s for task %s, keeping it pending", victims, worker, t.ID)
+				attempt.Error = fmt.Sprintf("%s, preempting %d tasks on node %s", attempt.Error, victims, worker)
+				recordAttempt(&te.Task, attempt)
+				if lost {
+					persisted := result.(*task.Task)
+					recordAttempt(persisted, attempt)
+					m.TaskDb.Put(persisted.Key(), persisted)
+				} else {
+					pending := te.Task
+					pending.State = task.Pending
+					m.TaskDb.Put(pending.Key(), &pending)
+				}
+				m.Pending.EnqueueAfter(te, pendingBackoff(te.Task))
+				return
+			}
+		}
+		recordAttempt(&t, attempt)
+		if err != nil && lost {
+			log.Printf("no worker for lost task %s yet, keeping it pending: %v", t.ID, err)
+			recordAttempt(&te.Task, attempt)
+			persisted := result.(*task.Task)
+			recordAttempt(persisted, attempt)
+			m.TaskDb.Put(persisted.Key(), persisted)
+			m.Pending.EnqueueAfter(te, pendingBackoff(te.Task))
+			return
+		}
+		if err != nil && t.Service != "" {
+			// the reconciler would replace a failed task with a new one
+			// every pass, a service task waits for a worker instead
+			log.Printf("no worker for task %s of service %s yet, keeping it pending: %v", t.ID, t.Service, err)
+			recordAttempt(&te.Task, attempt)
+			t.State = task.Pending
+			m.TaskDb.Put(t.Key(), &t)
+			m.Pending.EnqueueAfter(te, pendingBackoff(te.Task))
+			return
+		}
 		if err != nil {
 			log.Printf("error selecting worker for task %s: %v", t.ID, err)
+			t.State = task.Failed
+			m.TaskDb.Put(t.Key(), &t)
 			return
 		}
 
 		log.Printf("[manager] selected worker %s for task %s\n", w.Name, t.ID)
 
-		m.WorkerTaskMap[w.Name] = append(m.WorkerTaskMap[w.Name], te.Task.ID)
-		m.TaskWorkerMap[t.ID] = w.Name
+		m.assignTask(w.Name, t.ID)
 
 		t.State = task.Scheduled
-		m.TaskDb.Put(t.ID.String(), &t)
+		t.Node = w.Name
+		m.TaskDb.Put(t.Key(), &t)
 
 		data, err := json.Marshal(te)
 		if err != nil {
@@ -168,13 +261,16 @@ func (m *Manager) SendWork() {
 		url := fmt.Sprintf("http://%s/tasks", w.Name)
 		resp, err := http.Post(url, "application/json", bytes.NewBuffer(data))
 		if err != nil {
-			log.Printf("Error connecting to %v: %v", w, err)
-			m.Pending.Enqueue(t)
+			log.Printf("Error connecting to %v: %v", w.Name, err)
+			m.unsendTask(w.Name, &t, task.Pending)
+			m.Pending.Enqueue(te)
 			return
 		}
+		defer resp.Body.Close()
 
 		d := json.NewDecoder(resp.Body)
 		if resp.StatusCode != http.StatusCreated {
+			m.unsendTask(w.Name, &t, task.Failed)
 			e := worker.ErrResponse{}
 			err := d.Decode(&e)
 			if err != nil {
@@ -185,14 +281,14 @@ func (m *Manager) SendWork() {
 			return
 		}
 
-		t = task.Task{}
-		err = d.Decode(&t)
+		// decode into a fresh task, the store may hold a pointer to t
+		started := task.Task{}
+		err = d.Decode(&started)
 		if err != nil {
 			fmt.Printf("Error decoding response: %s\n", err.Error())
 			return
 		}
-		w.TaskCount++
-		log.Printf("[manager] received response from worker: %#v\n", t)
+		log.Printf("[manager] received response from worker: %#v\n", started)
 	} else {
 		log.Println("No work in the queue")
 	}
@@ -202,8 +298,9 @@ func (m *Manager) ProcessTasks() {
 	for {
 		log.Println("Processing any tasks in the queue")
 		m.SendWork()
-		log.Println("Sleeping for 10 seconds")
-		time.Sleep(10 * time.Second)
+		d := m.intervals().ProcessTasks.Duration
+		log.Printf("Sleeping for %v", d)
+		time.Sleep(d)
 	}
 }
 
@@ -220,7 +317,19 @@ func (m *Manager) GetTasks() []*task.Task {
 	return taskList.([]*task.Task)
 }
 
-func New(workers []string, schedulerType string, dbType string) *Manager {
+// namespaceTasks returns the tasks of a namespace.
+func (m *Manager) namespaceTasks(namespace string) []*task.Task {
+	tasks := []*task.Task{}
+	for _, t := range m.GetTasks() {
+		if t.InNamespace(namespace) {
+			tasks = append(tasks, t)
+		}
+	}
+	return tasks
+}
+
+func New(c config.Manager) *Manager {
+	workers := c.Workers
 
 	workerTaskMap := make(map[string][]uuid.UUID)
 	taskWorkerMap := make(map[uuid.UUID]string)
@@ -234,23 +343,26 @@ func New(workers []string, schedulerType string, dbType string) *Manager {
 		nodes = append(nodes, n)
 	}
 
-	var s scheduler.Scheduler
-	switch schedulerType {
-	case "epvm":
-		s = &scheduler.Epvm{Name: "epvm"}
-	case "roundrobin":
-		s = &scheduler.RoundRobin{Name: "roundrobin"}
-	default:
-		s = &scheduler.Epvm{Name: "wpvm"}
+	schedulers, err := newSchedulers(c)
+	if err != nil {
+		log.Fatalf("unable to create schedulers: %v", err)
 	}
 
 	m := &Manager{
-		Pending:       *queue.New(),
 		Workers:       workers,
 		WorkerTaskMap: workerTaskMap,
 		TaskWorkerMap: taskWorkerMap,
 		WorkerNodes:   nodes,
-		Scheduler:     s,
+		pollFailures:  make(map[string]int),
+		fenced:        make(map[uuid.UUID]string),
+		Drains:        make(map[string]*Drain),
+		Scheduler:     schedulers[c.Scheduler],
+		schedulers:    schedulers,
+		Config:        c,
+		Workflows:     make(map[uuid.UUID]*Workflow),
+		Services:      make(map[string]*Service),
+		Quotas:        make(map[string]*Quota),
+		Registry:      discovery.NewRegistry(),
 	}
 
 	var ts store.Store
@@ -258,13 +370,21 @@ func New(workers []string, schedulerType string, dbType string) *Manager {
 	var errTaskDb error
 	var errEventsDb error
 
-	switch dbType {
+	switch c.Store.Type {
 	case "memory":
 		ts = store.NewInMemoryTaskStore()
 		es = store.NewInMemoryTaskEventStore()
 	case "persistent":
-		ts, errTaskDb = store.NewTaskStore("tasks.db", 0600, "tasks")
-		es, errEventsDb = store.NewEventStore("events.db", 0600, "events")
+		var tasks *store.TaskStore
+		var events *store.EventStore
+		tasks, errTaskDb = store.NewTaskStore(c.Store.TaskFile, 0600, "tasks")
+		if errTaskDb == nil {
+			ts, errTaskDb = tasks, tasks.MigrateKeys()
+		}
+		events, errEventsDb = store.NewEventStore(c.Store.EventFile, 0600, "events")
+		if errEventsDb == nil {
+			es, errEventsDb = events, events.MigrateKeys()
+		}
 	}
 
 	if errTaskDb != nil {
@@ -276,15 +396,46 @@ func New(workers []string, schedulerType string, dbType string) *Manager {
 
 	m.TaskDb = ts
 	m.EventDb = es
+	m.restoreAssignments()
+	m.Ingress = proxy.NewHTTPProxy("", m.Registry)
+	m.L4 = proxy.NewL4Proxy("", m.Registry)
 
 	return m
 }
 
+func (m *Manager) intervals() config.ManagerIntervals {
+	m.configMu.RLock()
+	defer m.configMu.RUnlock()
+	return m.Config.Intervals
+}
+
+// Reload applies the settings of c that can change while the manager is
+// running. Changes to other settings are reported and ignored.
+func (m *Manager) Reload(c config.Manager) {
+	m.configMu.Lock()
+	defer m.configMu.Unlock()
+	old := m.Config
+	if old.Host != c.Host || old.Port != c.Port || old.DNSPort != c.DNSPort || old.IngressPort != c.IngressPort || old.Domain != c.Domain {
+		log.Printf("[manager] listen addresses changed, restart the manager to apply them")
+	}
+	if old.Store != c.Store || old.Scheduler != c.Scheduler || !reflect.DeepEqual(old.Profiles, c.Profiles) || strings.Join(old.Workers, ",") != strings.Join(c.Workers, ",") {
+		log.Printf("[manager] store, scheduler, profile or worker settings changed, restart the manager to apply them")
+	}
+	log.Printf("[manager] reloaded intervals: %+v, node timeouts: %+v", c.Intervals, c.Nodes)
+	old.Intervals = c.Intervals
+	old.Nodes = c.Nodes
+	m.Config = old
+}
+
 func (m *Manager) restartTask(t *task.Task) {
-	w := m.TaskWorkerMap[t.ID]
+	w, ok := m.workerFor(t.ID)
+	if !ok {
+		log.Printf("task %s was never assigned to a worker, not restarting it", t.ID)
+		return
+	}
 	t.State = task.Scheduled
 	t.RestartCount++
-	m.TaskDb.Put(t.ID.String(), t)
+	m.TaskDb.Put(t.Key(), t)
 
 	te := task.TaskEvent{
 		ID:        uuid.New(),
@@ -301,7 +452,7 @@ func (m *Manager) restartTask(t *task.Task) {
 	resp, err := http.Post(url, "application/json", bytes.NewBuffer(data))
 	if err != nil {
 		log.Printf("Error connecting to %v: %v", w, err)
-		m.Pending.Enqueue(t)
+		m.Pending.Enqueue(te)
 		return
 	}
 
@@ -328,6 +479,9 @@ func (m *Manager) restartTask(t *task.Task) {
 
 func (m *Manager) doHealthChecks() {
 	for _, t := range m.GetTasks() {
+		if m.isWorkflowTask(t.ID) {
+			continue
+		}
 		if t.State == task.Running && t.RestartCount < 3 {
 			err := m.checkTaskHealth(*t)
 			if err != nil {
@@ -335,7 +489,8 @@ func (m *Manager) doHealthChecks() {
 					m.restartTask(t)
 				}
 			}
-		} else if t.State == task.Failed && t.RestartCount < 3 {
+		} else if t.State == task.Failed && t.Service == "" && t.RestartCount < 3 {
+			// failed service tasks are replaced by the reconciler
 			m.restartTask(t)
 		}
 	}
@@ -346,8 +501,9 @@ func (m *Manager) DoHealthChecks() {
 		log.Println("Performing task health check")
 		m.doHealthChecks()
 		log.Println("Task health checks completed")
-		log.Println("Sleeping for 60 seconds")
-		time.Sleep(60 * time.Second)
+		d := m.intervals().HealthChecks.Duration
+		log.Printf("Sleeping for %v", d)
+		time.Sleep(d)
 	}
 }
 
@@ -361,21 +517,21 @@ func getHostPort(ports nat.PortMap) *string {
 func (m *Manager) checkTaskHealth(t task.Task) error {
 	log.Printf("Calling health check for task %s: %s\n", t.ID, t.HealthCheck)
 
-	w := m.TaskWorkerMap[t.ID]
+	w, _ := m.workerFor(t.ID)
 	hostPort := getHostPort(t.HostPorts)
-	worker := strings.Split(w, ":")
 	if hostPort == nil {
 		log.Printf("Have not collected task %s host port yet. Skipping.\n", t.ID)
 		return nil
 	}
-	url := fmt.Sprintf("http://%s:%s%s", worker[0], *hostPort, t.HealthCheck)
+	url := fmt.Sprintf("http://%s:%s%s", workerHost(w), *hostPort, t.HealthCheck)
 	log.Printf("Calling health check for task %s: %s\n", t.ID, url)
-	resp, err := http.Get(url)
+	resp, err := healthClient.Get(url)
 	if err != nil {
 		msg := fmt.Sprintf("Error connecting to health check %s", url)
 		log.Println(msg)
 		return errors.New(msg)
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		msg := fmt.Sprintf("Error health check for task %s did not return 200\n", t.ID)
@@ -388,22 +544,39 @@ func (m *Manager) checkTaskHealth(t task.Task) error {
 	return nil
 }
 
-func (m *Manager) stopTask(worker string, taskID string) {
+func (m *Manager) stopTask(worker string, taskID string) error {
 	client := &http.Client{}
 	url := fmt.Sprintf("http://%s/tasks/%s", worker, taskID)
 	req, err := http.NewRequest("DELETE", url, nil)
 	if err != nil {
 		log.Printf("error creating request to delete task %s: %v", taskID, err)
-		return
+		return err
 	}
 	resp, err := client.Do(req)
 	if err != nil {
 		log.Printf("error connecting to worker at %s: %v", url, err)
-		return
+		return err
 	}
 	if resp.StatusCode != 204 {
 		log.Printf("Error sending request: %v", err)
-		return
+		return fmt.Errorf("worker %s returned %d stopping task %s", worker, resp.StatusCode, taskID)
 	}
 	log.Printf("task %s has been scheduled to be stopped", taskID)
+	return nil
+}
+
+// terminateTask stops a task directly instead of going through the pending
+// queue and marks it Completed so it is no longer counted as active. Tasks
+// that were never assigned to a worker are dropped by SendWork.
+func (m *Manager) terminateTask(t *task.Task) error {
+	w, ok := m.workerFor(t.ID)
+	if ok {
+		err := m.stopTask(w, t.ID.String())
+		if err != nil {
+			return err
+		}
+	}
+	t.State = task.Completed
+	t.FinishTime = time.Now().UTC()
+	return m.TaskDb.Put(t.Key(), t)
 }
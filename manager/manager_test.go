@@ -0,0 +1,223 @@
+package manager
+
+import (
+	"cube/config"
+	"cube/node"
+	"cube/stats"
+	"cube/task"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/c9s/goprocinfo/linux"
+	"github.com/google/uuid"
+)
+
+// newTestManager returns a manager with in-memory stores and no workers.
+// It schedules round robin, which does not sample the load of the nodes.
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	c := config.DefaultManager()
+	c.Workers = nil
+	c.Store.Type = "memory"
+	c.Scheduler = "roundrobin"
+	return New(c)
+}
+
+// registerWorker registers a ready node at address with room for a few
+// tasks.
+func registerWorker(t *testing.T, m *Manager, address string) {
+	t.Helper()
+	_, err := m.Register(node.Registration{Name: address, Address: address, Cpu: 4, Memory: 1 << 20, Disk: 1 << 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fakeWorker serves the given tasks as the task list of a worker and
+// returns its address.
+func fakeWorker(t *testing.T, tasks []*task.Task) string {
+	t.Helper()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(tasks)
+	}))
+	t.Cleanup(s.Close)
+	return strings.TrimPrefix(s.URL, "http://")
+}
+
+func TestUpdateTasksCompletedBetweenPolls(t *testing.T) {
+	m := newTestManager(t)
+	id := uuid.New()
+	stored := &task.Task{ID: id, Name: "job", State: task.Scheduled}
+	m.TaskDb.Put(stored.Key(), stored)
+
+	// the worker already reports the task as completed, it never saw a
+	// poll while it was running
+	reported := *stored
+	reported.State = task.Completed
+	worker := fakeWorker(t, []*task.Task{&reported})
+	m.Workers = []string{worker}
+	m.assignTask(worker, id)
+
+	m.updateTasks()
+
+	result, err := m.TaskDb.Get(task.Key("", id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := result.(*task.Task).State; got != task.Completed {
+		t.Errorf("state = %v, want %v", got, task.Completed)
+	}
+}
+
+func TestHealthChecksLeaveFailedServiceTasks(t *testing.T) {
+	m := newTestManager(t)
+	worker := fakeWorker(t, nil)
+	m.Workers = []string{worker}
+
+	standalone := &task.Task{ID: uuid.New(), Name: "job", State: task.Failed}
+	replica := &task.Task{ID: uuid.New(), Name: "web-1", Service: "web", State: task.Failed}
+	for _, tk := range []*task.Task{standalone, replica} {
+		m.TaskDb.Put(tk.Key(), tk)
+		m.assignTask(worker, tk.ID)
+	}
+
+	m.doHealthChecks()
+
+	tests := []struct {
+		task *task.Task
+		want int
+	}{
+		{standalone, 1},
+		{replica, 0},
+	}
+	for _, tt := range tests {
+		result, err := m.TaskDb.Get(tt.task.Key())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := result.(*task.Task).RestartCount; got != tt.want {
+			t.Errorf("%s restarted %d times, want %d", tt.task.Name, got, tt.want)
+		}
+	}
+}
+
+func TestSendWorkUndoesFailedSends(t *testing.T) {
+	refused := httptest.NewServer(http.NotFoundHandler())
+	refused.Close()
+	rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 500, Message: "no"})
+	}))
+	defer rejecting.Close()
+
+	tests := []struct {
+		name    string
+		url     string
+		state   task.State
+		pending int
+	}{
+		{"unreachable worker", refused.URL, task.Pending, 1},
+		{"rejecting worker", rejecting.URL, task.Failed, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(t)
+			worker := strings.TrimPrefix(tt.url, "http://")
+			registerWorker(t, m, worker)
+			tk := task.Task{ID: uuid.New(), Name: "job", State: task.Scheduled, Cpu: 1}
+			m.AddTask(task.TaskEvent{ID: uuid.New(), State: task.Running, Task: tk})
+
+			m.SendWork()
+
+			if _, ok := m.workerFor(tk.ID); ok {
+				t.Error("task is still assigned")
+			}
+			result, err := m.TaskDb.Get(tk.Key())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := result.(*task.Task).State; got != tt.state {
+				t.Errorf("state = %v, want %v", got, tt.state)
+			}
+			if got := m.Pending.Len(); got != tt.pending {
+				t.Errorf("%d events pending, want %d", got, tt.pending)
+			}
+			for _, n := range m.nodes() {
+				if n.CpuAllocated != 0 {
+					t.Errorf("node %s still reserves %g cpu", n.Name, n.CpuAllocated)
+				}
+			}
+		})
+	}
+}
+
+func TestSendWorkBacksOffUnplaceableTasks(t *testing.T) {
+	accepting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(task.Task{})
+	}))
+	defer accepting.Close()
+
+	m := newTestManager(t)
+	registerWorker(t, m, strings.TrimPrefix(accepting.URL, "http://"))
+	big := &task.Task{ID: uuid.New(), Name: "big", PriorityClass: "critical", State: task.Lost, Cpu: 100}
+	m.TaskDb.Put(big.Key(), big)
+	small := task.Task{ID: uuid.New(), Name: "small", PriorityClass: "best-effort", State: task.Pending, Cpu: 1}
+	m.AddTask(task.TaskEvent{ID: uuid.New(), State: task.Running, Task: *big})
+	m.AddTask(task.TaskEvent{ID: uuid.New(), State: task.Running, Task: small})
+
+	for i := 0; i < 2; i++ {
+		m.SendWork()
+	}
+
+	if _, ok := m.workerFor(small.ID); !ok {
+		t.Error("lower priority task was not placed while the unplaceable task waits")
+	}
+	if _, ok := m.workerFor(big.ID); ok {
+		t.Error("unplaceable task was placed")
+	}
+	if got := m.Pending.Len(); got != 1 {
+		t.Errorf("%d events pending, want the unplaceable task kept", got)
+	}
+}
+
+func TestUpdateCapacity(t *testing.T) {
+	statsWorker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(stats.Stats{
+			MemStats:  &linux.MemInfo{MemTotal: 2048},
+			DiskStats: &linux.Disk{All: 4096},
+			CpuCount:  2,
+		})
+	}))
+	defer statsWorker.Close()
+
+	tests := []struct {
+		name string
+		reg  node.Registration
+		want node.Node
+	}{
+		{"static worker", node.Registration{}, node.Node{Cpu: 2, Memory: 2048, Disk: 4096}},
+		{"registered worker", node.Registration{Cpu: 8, Memory: 1 << 20, Disk: 1 << 30}, node.Node{Cpu: 8, Memory: 1 << 20, Disk: 1 << 30}},
+		{"partly reported", node.Registration{Cpu: 8}, node.Node{Cpu: 8, Memory: 2048, Disk: 4096}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(t)
+			tt.reg.Address = strings.TrimPrefix(statsWorker.URL, "http://")
+			_, err := m.Register(tt.reg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			m.updateCapacity()
+
+			n := m.nodes()[0]
+			if n.Cpu != tt.want.Cpu || n.Memory != tt.want.Memory || n.Disk != tt.want.Disk {
+				t.Errorf("capacity = %g cpu, %d memory, %d disk, want %g, %d, %d", n.Cpu, n.Memory, n.Disk, tt.want.Cpu, tt.want.Memory, tt.want.Disk)
+			}
+		})
+	}
+}
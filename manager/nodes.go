@@ -0,0 +1,462 @@
+package manager
+
+import (
+	"cube/node"
+	"cube/scheduler"
+	"cube/stats"
+	"cube/task"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrUnknownNode = errors.New("unknown node")
+
+// pollClient is used to poll workers for task updates. The timeout makes a
+// hung worker count as a failed poll instead of blocking the loop.
+var pollClient = &http.Client{Timeout: 5 * time.Second}
+
+// healthClient calls task health checks, so that a hung task cannot stall
+// the loops that check it.
+var healthClient = &http.Client{Timeout: 5 * time.Second}
+
+// streamClient only bounds the wait for the response headers, the body of
+// a followed log may stream for as long as the caller stays connected.
+var streamClient = &http.Client{Transport: &http.Transport{ResponseHeaderTimeout: 5 * time.Second}}
+
+// workerFor returns the worker a task has been assigned to.
+func (m *Manager) workerFor(id uuid.UUID) (string, bool) {
+	m.nodeMu.RLock()
+	defer m.nodeMu.RUnlock()
+	w, ok := m.TaskWorkerMap[id]
+	return w, ok
+}
+
+// assignTask records that worker runs a task. A task that was assigned
+// before, for example when sending it to a worker failed, is moved so its
+// resources are only reserved once.
+func (m *Manager) assignTask(worker string, id uuid.UUID) {
+	m.nodeMu.Lock()
+	defer m.nodeMu.Unlock()
+	if prev, ok := m.TaskWorkerMap[id]; ok {
+		m.removeAssignment(prev, id)
+	}
+	m.WorkerTaskMap[worker] = append(m.WorkerTaskMap[worker], id)
+	m.TaskWorkerMap[id] = worker
+}
+
+// removeAssignment drops a task from the list of worker. The caller holds
+// nodeMu.
+func (m *Manager) removeAssignment(worker string, id uuid.UUID) {
+	ids := m.WorkerTaskMap[worker]
+	for i := range ids {
+		if ids[i] == id {
+			m.WorkerTaskMap[worker] = append(ids[:i:i], ids[i+1:]...)
+			return
+		}
+	}
+}
+
+// workers returns the addresses of all known workers.
+func (m *Manager) workers() []string {
+	m.nodeMu.RLock()
+	defer m.nodeMu.RUnlock()
+	return append([]string(nil), m.Workers...)
+}
+
+func (m *Manager) workerNode(name string) *node.Node {
+	m.nodeMu.RLock()
+	defer m.nodeMu.RUnlock()
+	for _, n := range m.WorkerNodes {
+		if n.Name == name {
+			return n
+		}
+	}
+	return nil
+}
+
+// nodes returns a copy of every known node, safe to hand to API clients.
+func (m *Manager) nodes() []node.Node {
+	m.refreshNodeTasks()
+	m.nodeMu.RLock()
+	defer m.nodeMu.RUnlock()
+	nodes := make([]node.Node, 0, len(m.WorkerNodes))
+	for _, n := range m.WorkerNodes {
+		nodes = append(nodes, *n)
+	}
+	return nodes
+}
+
+// readyNodes returns the nodes that may receive task t. A node still
+// holding a fenced copy of t is skipped so the copies cannot collide.
+func (m *Manager) readyNodes(t task.Task) []*node.Node {
+	m.nodeMu.RLock()
+	defer m.nodeMu.RUnlock()
+	var nodes []*node.Node
+	for _, n := range m.WorkerNodes {
+		if n.Status == node.Ready && m.fenced[t.ID] != n.Name {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// restoreAssignments rebuilds the task to worker maps from the tasks in
+// the store after a restart, so the resources held by tasks that are still
+// running are accounted for before anything new is scheduled.
+func (m *Manager) restoreAssignments() {
+	restored := 0
+	for _, t := range m.GetTasks() {
+		if t.Node == "" || (t.State != task.Scheduled && t.State != task.Running) {
+			continue
+		}
+		m.assignTask(t.Node, t.ID)
+		restored++
+	}
+	if restored > 0 {
+		log.Printf("[manager] restored the assignments of %d tasks", restored)
+	}
+}
+
+// refreshNodeTasks records on every node the active tasks assigned to it,
+// which the scheduler evaluates inter-task affinity against, and the
+// resources they reserve. A task reserves its requests from the moment it
+// is assigned until it completes, fails or is taken off the node.
+func (m *Manager) refreshNodeTasks() {
+	tasks := make(map[uuid.UUID]*task.Task)
+	for _, t := range m.GetTasks() {
+		tasks[t.ID] = t
+	}
+
+	m.nodeMu.Lock()
+	defer m.nodeMu.Unlock()
+	for _, n := range m.WorkerNodes {
+		n.Tasks = nil
+		n.TaskCount = 0
+		n.CpuAllocated = 0
+		n.MemoryAllocated = 0
+		n.DiskAllocated = 0
+		n.PortsAllocated = nil
+		for _, id := range m.WorkerTaskMap[n.Name] {
+			t, ok := tasks[id]
+			if !ok || (t.State != task.Scheduled && t.State != task.Running) {
+				continue
+			}
+			scheduler.Reserve(n, t)
+		}
+	}
+}
+
+// Register adds a worker to the cluster or refreshes the capacity,
+// labels and taints of a worker that is already known. Workers are keyed by the
+// address they advertise.
+func (m *Manager) Register(reg node.Registration) (node.Node, error) {
+	if reg.Address == "" {
+		return node.Node{}, errors.New("registration needs an address")
+	}
+	for _, t := range reg.Taints {
+		err := t.Validate()
+		if err != nil {
+			return node.Node{}, err
+		}
+	}
+	m.nodeMu.Lock()
+	defer m.nodeMu.Unlock()
+
+	var n *node.Node
+	for _, wn := range m.WorkerNodes {
+		if wn.Name == reg.Address {
+			n = wn
+			break
+		}
+	}
+	if n == nil {
+		n = node.NewNode(reg.Address, fmt.Sprintf("http://%s", reg.Address), "worker")
+		m.Workers = append(m.Workers, reg.Address)
+		m.WorkerNodes = append(m.WorkerNodes, n)
+		if _, ok := m.WorkerTaskMap[reg.Address]; !ok {
+			m.WorkerTaskMap[reg.Address] = []uuid.UUID{}
+		}
+		log.Printf("[manager] registered worker %s at %s", reg.Name, reg.Address)
+	}
+
+	n.WorkerName = reg.Name
+	n.Cpu = reg.Cpu
+	n.Memory = reg.Memory
+	n.Disk = reg.Disk
+	if reg.Labels != nil {
+		n.Labels = reg.Labels
+	}
+	if reg.Taints != nil {
+		n.Taints = reg.Taints
+	}
+	n.Status = node.Ready
+	n.LastHeartbeat = time.Now().UTC()
+	return *n, nil
+}
+
+// Heartbeat records that the worker at address is alive. It returns
+// ErrUnknownNode for workers that have not registered, for example after
+// a manager restart, so they can register again.
+func (m *Manager) Heartbeat(address string) error {
+	max := m.maxPollFailures()
+	m.nodeMu.Lock()
+	defer m.nodeMu.Unlock()
+	for _, n := range m.WorkerNodes {
+		if n.Name == address {
+			n.LastHeartbeat = time.Now().UTC()
+			if m.pollFailures[address] < max {
+				n.Status = node.Ready
+			}
+			return nil
+		}
+	}
+	return ErrUnknownNode
+}
+
+func (m *Manager) maxPollFailures() int {
+	m.configMu.RLock()
+	defer m.configMu.RUnlock()
+	return m.Config.Nodes.MaxPollFailures
+}
+
+// markSeen counts a successful poll of a worker as a heartbeat, which keeps
+// statically configured workers that do not send heartbeats Ready.
+func (m *Manager) markSeen(worker string) {
+	m.nodeMu.Lock()
+	delete(m.pollFailures, worker)
+	m.nodeMu.Unlock()
+	m.Heartbeat(worker)
+}
+
+// pollFailed records a failed poll of a worker. The node is considered
+// failed once too many polls in a row have failed.
+func (m *Manager) pollFailed(worker string) {
+	max := m.maxPollFailures()
+	m.nodeMu.Lock()
+	m.pollFailures[worker]++
+	failures := m.pollFailures[worker]
+	var failed bool
+	for _, n := range m.WorkerNodes {
+		if n.Name == worker && failures >= max && n.Status != node.Unknown {
+			log.Printf("[manager] node %s changed from %v to %v after %d failed polls", n.Name, n.Status, node.Unknown, failures)
+			n.Status = node.Unknown
+			failed = true
+		}
+	}
+	m.nodeMu.Unlock()
+	if failed {
+		m.failNode(worker)
+	}
+}
+
+// failNode marks the tasks of a failed node Lost and queues them for
+// rescheduling on healthy nodes. The copies left on the failed node are
+// fenced: they are stopped if the node comes back.
+func (m *Manager) failNode(worker string) {
+	for _, t := range m.assignedTasks(worker) {
+		if m.loseTask(worker, t) {
+			log.Printf("[manager] task %s was lost with node %s, rescheduling it", t.ID, worker)
+		}
+	}
+}
+
+// assignedTasks returns the stored tasks assigned to worker. Assignments
+// only record task IDs, so the tasks of every namespace are searched.
+func (m *Manager) assignedTasks(worker string) []*task.Task {
+	m.nodeMu.RLock()
+	assigned := make(map[uuid.UUID]bool)
+	for _, id := range m.WorkerTaskMap[worker] {
+		assigned[id] = true
+	}
+	m.nodeMu.RUnlock()
+
+	var tasks []*task.Task
+	for _, t := range m.GetTasks() {
+		if assigned[t.ID] {
+			tasks = append(tasks, t)
+		}
+	}
+	return tasks
+}
+
+// unsendTask takes back a task that never reached worker and stores it
+// in state. Unlike unassignTask nothing runs on the worker, so no copy
+// needs to be fenced, and the resources reserved for the task are freed.
+func (m *Manager) unsendTask(worker string, t *task.Task, state task.State) {
+	m.nodeMu.Lock()
+	m.removeAssignment(worker, t.ID)
+	if m.TaskWorkerMap[t.ID] == worker {
+		delete(m.TaskWorkerMap, t.ID)
+	}
+	m.nodeMu.Unlock()
+	t.State = state
+	t.Node = ""
+	m.TaskDb.Put(t.Key(), t)
+}
+
+// unassignTask removes a task from worker and fences the copy it may still
+// run there.
+func (m *Manager) unassignTask(worker string, id uuid.UUID) {
+	m.nodeMu.Lock()
+	defer m.nodeMu.Unlock()
+	m.removeAssignment(worker, id)
+	if m.TaskWorkerMap[id] == worker {
+		delete(m.TaskWorkerMap, id)
+		m.fenced[id] = worker
+	}
+}
+
+// loseTask takes a task away from worker. Active tasks are marked Lost and
+// queued to be scheduled again, in which case it returns true.
+func (m *Manager) loseTask(worker string, t *task.Task) bool {
+	m.unassignTask(worker, t.ID)
+	if !task.ValidStateTransition(t.State, task.Lost) {
+		return false
+	}
+	t.State = task.Lost
+	m.TaskDb.Put(t.Key(), t)
+	m.reschedule(*t)
+	return true
+}
+
+// reschedule queues a fresh copy of a lost task.
+func (m *Manager) reschedule(t task.Task) {
+	t.State = task.Scheduled
+	t.ContainerID = ""
+	t.HostPorts = nil
+	t.Node = ""
+	t.StartTime = time.Time{}
+	t.FinishTime = time.Time{}
+	m.AddTask(task.TaskEvent{
+		ID:        uuid.New(),
+		State:     task.Running,
+		Timestamp: time.Now().UTC(),
+		Task:      t,
+	})
+}
+
+// fence stops a copy of a task left on a node the task was rescheduled
+// away from. It reports whether the copy reported by worker is stale and
+// must not update the task.
+func (m *Manager) fence(worker string, t *task.Task) bool {
+	m.nodeMu.RLock()
+	fencedOn, fenced := m.fenced[t.ID]
+	assigned, ok := m.TaskWorkerMap[t.ID]
+	m.nodeMu.RUnlock()
+	if !fenced || fencedOn != worker {
+		return ok && assigned != worker
+	}
+	if t.State == task.Scheduled || t.State == task.Running {
+		log.Printf("[manager] stopping fenced copy of task %s on node %s", t.ID, worker)
+		m.stopTask(worker, t.ID.String())
+		return true
+	}
+	m.nodeMu.Lock()
+	delete(m.fenced, t.ID)
+	m.nodeMu.Unlock()
+	return true
+}
+
+func (m *Manager) updateNodeStatuses() {
+	m.configMu.RLock()
+	notReadyAfter := m.Config.Nodes.NotReadyAfter.Duration
+	unknownAfter := m.Config.Nodes.UnknownAfter.Duration
+	maxPollFailures := m.Config.Nodes.MaxPollFailures
+	m.configMu.RUnlock()
+
+	var failed []string
+	m.nodeMu.Lock()
+	now := time.Now().UTC()
+	for _, n := range m.WorkerNodes {
+		if n.LastHeartbeat.IsZero() {
+			continue
+		}
+		status := node.Ready
+		age := now.Sub(n.LastHeartbeat)
+		if age > unknownAfter {
+			status = node.Unknown
+		} else if age > notReadyAfter {
+			status = node.NotReady
+		}
+		if m.pollFailures[n.Name] >= maxPollFailures {
+			status = node.Unknown
+		}
+		if status != n.Status {
+			log.Printf("[manager] node %s changed from %v to %v, last heartbeat %v ago", n.Name, n.Status, status, age.Round(time.Second))
+			if status == node.Unknown {
+				failed = append(failed, n.Name)
+			}
+			n.Status = status
+		}
+	}
+	m.nodeMu.Unlock()
+
+	for _, name := range failed {
+		m.failNode(name)
+	}
+}
+
+// updateCapacity asks the workers that have not reported their capacity,
+// such as statically configured ones, for their stats. Until it is known
+// the scheduler does not place tasks with requests on them.
+func (m *Manager) updateCapacity() {
+	m.nodeMu.Lock()
+	var unknown []string
+	for _, n := range m.WorkerNodes {
+		if n.Cpu <= 0 || n.Memory <= 0 || n.Disk <= 0 {
+			unknown = append(unknown, n.Name)
+		}
+	}
+	m.nodeMu.Unlock()
+
+	for _, name := range unknown {
+		resp, err := pollClient.Get(fmt.Sprintf("http://%s/stats", name))
+		if err != nil {
+			log.Printf("[manager] error getting the capacity of node %s: %v", name, err)
+			continue
+		}
+		var s stats.Stats
+		err = json.NewDecoder(resp.Body).Decode(&s)
+		resp.Body.Close()
+		if err != nil {
+			log.Printf("[manager] error decoding the stats of node %s: %v", name, err)
+			continue
+		}
+
+		m.nodeMu.Lock()
+		for _, n := range m.WorkerNodes {
+			if n.Name != name {
+				continue
+			}
+			if n.Cpu <= 0 && s.CpuCount > 0 {
+				n.Cpu = float64(s.CpuCount)
+			}
+			if n.Memory <= 0 && s.MemStats != nil {
+				n.Memory = int64(s.MemTotalKb())
+			}
+			if n.Disk <= 0 && s.DiskStats != nil {
+				n.Disk = int64(s.DiskTotal())
+			}
+		}
+		m.nodeMu.Unlock()
+	}
+}
+
+func (m *Manager) MonitorNodes() {
+	for {
+		log.Println("Checking node heartbeats")
+		m.updateNodeStatuses()
+		m.updateCapacity()
+		m.drainNodes()
+		m.enforceTaints()
+		d := m.intervals().NodeMonitor.Duration
+		log.Printf("Sleeping for %v", d)
+		time.Sleep(d)
+	}
+}
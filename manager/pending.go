@@ -0,0 +1,107 @@
+package manager
+
+import (
+	"container/heap"
+	"cube/task"
+	"sync"
+	"time"
+)
+
+// PendingQueue hands out task events by priority, first in first out
+// within a priority. Stop requests go first since they free resources.
+// Events put back with EnqueueAfter wait out their backoff without
+// holding up the events behind them.
+type PendingQueue struct {
+	mu    sync.Mutex
+	items pendingHeap
+	seq   int
+}
+
+type pendingItem struct {
+	event     task.TaskEvent
+	priority  int
+	seq       int
+	notBefore time.Time
+}
+
+type pendingHeap []pendingItem
+
+func (h pendingHeap) Len() int { return len(h) }
+
+func (h pendingHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h pendingHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *pendingHeap) Push(x interface{}) { *h = append(*h, x.(pendingItem)) }
+
+func (h *pendingHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// stopPriority ranks stop requests above every priority class.
+const stopPriority = int(^uint(0) >> 1)
+
+func (q *PendingQueue) Enqueue(v interface{}) {
+	q.EnqueueAfter(v, 0)
+}
+
+// EnqueueAfter queues a task event that is not handed out before d has
+// passed.
+func (q *PendingQueue) EnqueueAfter(v interface{}, d time.Duration) {
+	te := v.(task.TaskEvent)
+	priority := te.Task.Priority()
+	if te.State == task.Completed {
+		priority = stopPriority
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.seq++
+	heap.Push(&q.items, pendingItem{event: te, priority: priority, seq: q.seq, notBefore: time.Now().Add(d)})
+}
+
+// Dequeue returns the next task event that is due, or nil if there is
+// none.
+func (q *PendingQueue) Dequeue() interface{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	var waiting []pendingItem
+	defer func() {
+		for _, item := range waiting {
+			heap.Push(&q.items, item)
+		}
+	}()
+	for len(q.items) > 0 {
+		item := heap.Pop(&q.items).(pendingItem)
+		if item.notBefore.After(now) {
+			waiting = append(waiting, item)
+			continue
+		}
+		return item.event
+	}
+	return nil
+}
+
+func (q *PendingQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// pendingBackoff is how long a task that could not be placed waits before
+// it is tried again, doubling with every failed scheduling attempt.
+func pendingBackoff(t task.Task) time.Duration {
+	attempts := len(t.Scheduling)
+	if attempts == 0 {
+		return 0
+	}
+	return time.Second << (attempts - 1)
+}
@@ -0,0 +1,73 @@
+package manager
+
+import (
+	"cube/task"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPendingQueueOrder(t *testing.T) {
+	event := func(name, class string, state task.State) task.TaskEvent {
+		return task.TaskEvent{State: state, Task: task.Task{Name: name, PriorityClass: class}}
+	}
+	tests := []struct {
+		name   string
+		events []task.TaskEvent
+		want   []string
+	}{
+		{
+			name:   "first in first out within a class",
+			events: []task.TaskEvent{event("a", "", task.Scheduled), event("b", "", task.Scheduled), event("c", "normal", task.Scheduled)},
+			want:   []string{"a", "b", "c"},
+		},
+		{
+			name:   "higher classes first",
+			events: []task.TaskEvent{event("low", "best-effort", task.Scheduled), event("normal", "", task.Scheduled), event("critical", "critical", task.Scheduled), event("high", "high", task.Scheduled)},
+			want:   []string{"critical", "high", "normal", "low"},
+		},
+		{
+			name:   "stop requests before anything else",
+			events: []task.TaskEvent{event("critical", "critical", task.Scheduled), event("stop", "best-effort", task.Completed), event("high", "high", task.Scheduled)},
+			want:   []string{"stop", "critical", "high"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var q PendingQueue
+			for _, e := range tt.events {
+				q.Enqueue(e)
+			}
+			if q.Len() != len(tt.events) {
+				t.Fatalf("Len() = %d, want %d", q.Len(), len(tt.events))
+			}
+			var got []string
+			for q.Len() > 0 {
+				got = append(got, q.Dequeue().(task.TaskEvent).Task.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("dequeued %v, want %v", got, tt.want)
+			}
+			if q.Dequeue() != nil {
+				t.Error("Dequeue() on an empty queue is not nil")
+			}
+		})
+	}
+}
+
+func TestPendingQueueBackoff(t *testing.T) {
+	var q PendingQueue
+	q.EnqueueAfter(task.TaskEvent{Task: task.Task{Name: "waiting", PriorityClass: "critical"}}, time.Hour)
+	q.Enqueue(task.TaskEvent{Task: task.Task{Name: "due", PriorityClass: "best-effort"}})
+
+	e := q.Dequeue()
+	if e == nil || e.(task.TaskEvent).Task.Name != "due" {
+		t.Fatalf("Dequeue() = %v, want the due event", e)
+	}
+	if e := q.Dequeue(); e != nil {
+		t.Errorf("Dequeue() = %v, want nil while the other event waits", e)
+	}
+	if q.Len() != 1 {
+		t.Errorf("Len() = %d, want the waiting event kept", q.Len())
+	}
+}
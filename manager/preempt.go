@@ -0,0 +1,66 @@
+package manager
+
+import (
+	"cube/scheduler"
+	"cube/task"
+	"fmt"
+	"log"
+)
+
+// preempt stops tasks of lower priority than t on the node where that
+// makes room for t. Victims are stopped gracefully by their workers:
+// service tasks are replaced by the reconciler and other tasks are queued
+// again like lost ones. It returns the node and the number of victims, or
+// false if no node can be freed.
+func (m *Manager) preempt(t task.Task) (string, int, bool) {
+	if t.Priority() == 0 {
+		return "", 0, false
+	}
+	s, err := m.schedulerFor(t)
+	if err != nil {
+		return "", 0, false
+	}
+	tasks := make(map[string]task.Task)
+	for _, pt := range m.GetTasks() {
+		tasks[pt.ID.String()] = *pt
+	}
+	n, victims := scheduler.Victims(s, t, m.readySnapshot(), tasks)
+	if n == nil {
+		return "", 0, false
+	}
+
+	class := t.PriorityClass
+	if class == "" {
+		class = task.DefaultPriorityClass
+	}
+	for _, v := range victims {
+		result, err := m.TaskDb.Get(v.Key())
+		if err != nil {
+			continue
+		}
+		victim := result.(*task.Task)
+		reason := fmt.Sprintf("preempted task %s on node %s for task %s of priority class %s", victim.ID, n.Name, t.ID, class)
+		if victim.Service != "" {
+			if svc, err := m.GetService(victim.Namespace, victim.Service); err == nil {
+				err = m.terminateTask(victim)
+				if err != nil {
+					log.Printf("[manager] error preempting task %s on node %s: %v", victim.ID, n.Name, err)
+					continue
+				}
+				m.serviceMu.Lock()
+				svc.recordEvent("Preempted", reason)
+				m.serviceMu.Unlock()
+				log.Printf("[manager] %s", reason)
+				continue
+			}
+		}
+		err = m.stopTask(n.Name, victim.ID.String())
+		if err != nil {
+			log.Printf("[manager] error preempting task %s on node %s: %v", victim.ID, n.Name, err)
+			continue
+		}
+		m.loseTask(n.Name, victim)
+		log.Printf("[manager] %s", reason)
+	}
+	return n.Name, len(victims), true
+}
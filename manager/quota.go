@@ -0,0 +1,193 @@
+package manager
+
+import (
+	"cube/task"
+	"errors"
+	"fmt"
+	"log"
+)
+
+var (
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	ErrTaskExists    = errors.New("task already exists")
+)
+
+// Resources are the requests of a task, or their sum over tasks. Memory and
+// disk are in bytes.
+type Resources struct {
+	Cpu    float64
+	Memory int64
+	Disk   int64
+}
+
+func (r Resources) validate() error {
+	if r.Cpu < 0 || r.Memory < 0 || r.Disk < 0 {
+		return errors.New("resources must not be negative")
+	}
+	return nil
+}
+
+// LimitRange bounds the requests of each task in a namespace. Default fills
+// in the requests a task leaves at zero, Max caps them. Zero values are not
+// applied.
+type LimitRange struct {
+	Default Resources
+	Max     Resources
+}
+
+func (l *LimitRange) validate() error {
+	err := l.Default.validate()
+	if err != nil {
+		return err
+	}
+	err = l.Max.validate()
+	if err != nil {
+		return err
+	}
+	if exceeds(l.Default, l.Max) != "" {
+		return errors.New("default requests must not exceed the maximum")
+	}
+	return nil
+}
+
+// Quota caps the total requests and the number of active tasks of a
+// namespace. Zero means no limit.
+type Quota struct {
+	Cpu    float64
+	Memory int64
+	Disk   int64
+	Tasks  int
+	Limits LimitRange
+}
+
+func (q *Quota) validate() error {
+	if q.Cpu < 0 || q.Memory < 0 || q.Disk < 0 || q.Tasks < 0 {
+		return errors.New("quota must not be negative")
+	}
+	return q.Limits.validate()
+}
+
+// QuotaStatus reports the quota of a namespace and what its active tasks
+// use of it.
+type QuotaStatus struct {
+	Namespace string
+	Quota     *Quota
+	Used      Resources
+	Tasks     int
+}
+
+// exceeds names the first resource of r above a non-zero limit.
+func exceeds(r Resources, limit Resources) string {
+	switch {
+	case limit.Cpu > 0 && r.Cpu > limit.Cpu:
+		return fmt.Sprintf("cpu %g over %g", r.Cpu, limit.Cpu)
+	case limit.Memory > 0 && r.Memory > limit.Memory:
+		return fmt.Sprintf("memory %d over %d", r.Memory, limit.Memory)
+	case limit.Disk > 0 && r.Disk > limit.Disk:
+		return fmt.Sprintf("disk %d over %d", r.Disk, limit.Disk)
+	}
+	return ""
+}
+
+// SetQuota sets the quota of a namespace, or removes it when q is nil.
+func (m *Manager) SetQuota(namespace string, q *Quota) (QuotaStatus, error) {
+	if q != nil {
+		err := q.validate()
+		if err != nil {
+			return QuotaStatus{}, err
+		}
+	}
+	m.quotaMu.Lock()
+	if q == nil {
+		delete(m.Quotas, namespace)
+	} else {
+		m.Quotas[namespace] = q
+	}
+	m.quotaMu.Unlock()
+	log.Printf("[quota] set quota of namespace %s to %+v", namespace, q)
+	return m.GetQuota(namespace), nil
+}
+
+func (m *Manager) GetQuota(namespace string) QuotaStatus {
+	m.quotaMu.Lock()
+	defer m.quotaMu.Unlock()
+	used, tasks := m.namespaceUsage(namespace)
+	return QuotaStatus{Namespace: namespace, Quota: m.Quotas[namespace], Used: used, Tasks: tasks}
+}
+
+// namespaceUsage sums the requests of the active tasks of a namespace in
+// the task store.
+func (m *Manager) namespaceUsage(namespace string) (Resources, int) {
+	var used Resources
+	tasks := 0
+	for _, t := range m.namespaceTasks(namespace) {
+		if !isActive(t) {
+			continue
+		}
+		used.Cpu += t.Cpu
+		used.Memory += t.Memory
+		used.Disk += t.Disk
+		tasks++
+	}
+	return used, tasks
+}
+
+// admitTask applies the limit range of the namespace of t and checks that
+// t fits in its quota. An admitted task is stored as Pending, so that it
+// counts against the quota while it waits in the queue. A task whose ID is
+// taken is rejected rather than overwriting the stored one.
+func (m *Manager) admitTask(t *task.Task) error {
+	t.Namespace = task.NamespaceOf(t.Namespace)
+	m.quotaMu.Lock()
+	defer m.quotaMu.Unlock()
+	if _, err := m.TaskDb.Get(t.Key()); err == nil {
+		return fmt.Errorf("%w: %s in namespace %s", ErrTaskExists, t.ID, t.Namespace)
+	}
+	err := m.checkQuota(t, nil)
+	if err != nil {
+		return err
+	}
+
+	pending := *t
+	pending.State = task.Pending
+	return m.TaskDb.Put(pending.Key(), &pending)
+}
+
+// checkQuota applies the limit range of the namespace of t and checks that
+// t fits in its quota next to the active tasks and the planned ones, which
+// are not stored yet. The caller holds quotaMu.
+func (m *Manager) checkQuota(t *task.Task, planned []task.Task) error {
+	q, ok := m.Quotas[task.NamespaceOf(t.Namespace)]
+	if !ok {
+		return nil
+	}
+	if t.Cpu == 0 {
+		t.Cpu = q.Limits.Default.Cpu
+	}
+	if t.Memory == 0 {
+		t.Memory = q.Limits.Default.Memory
+	}
+	if t.Disk == 0 {
+		t.Disk = q.Limits.Default.Disk
+	}
+	requests := Resources{Cpu: t.Cpu, Memory: t.Memory, Disk: t.Disk}
+	if reason := exceeds(requests, q.Limits.Max); reason != "" {
+		return fmt.Errorf("task %s requests more than allowed in namespace %s: %s", t.Name, t.Namespace, reason)
+	}
+
+	used, tasks := m.namespaceUsage(t.Namespace)
+	for _, p := range planned {
+		used.Cpu += p.Cpu
+		used.Memory += p.Memory
+		used.Disk += p.Disk
+		tasks++
+	}
+	if q.Tasks > 0 && tasks+1 > q.Tasks {
+		return fmt.Errorf("%w in namespace %s: %d of %d tasks", ErrQuotaExceeded, t.Namespace, tasks, q.Tasks)
+	}
+	total := Resources{Cpu: used.Cpu + t.Cpu, Memory: used.Memory + t.Memory, Disk: used.Disk + t.Disk}
+	if reason := exceeds(total, Resources{Cpu: q.Cpu, Memory: q.Memory, Disk: q.Disk}); reason != "" {
+		return fmt.Errorf("%w in namespace %s: %s", ErrQuotaExceeded, t.Namespace, reason)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package manager
+
+import (
+	"cube/task"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestAdmitTask(t *testing.T) {
+	limits := LimitRange{
+		Default: Resources{Cpu: 0.5, Memory: 1 << 20},
+		Max:     Resources{Cpu: 2},
+	}
+	tests := []struct {
+		name      string
+		quota     *Quota
+		task      task.Task
+		wantErr   error
+		wantCpu   float64
+		wantStore bool
+	}{
+		{"no quota", nil, task.Task{Cpu: 3}, nil, 3, true},
+		{"within quota", &Quota{Cpu: 4, Tasks: 3}, task.Task{Cpu: 2}, nil, 2, true},
+		{"defaults fill in requests", &Quota{Limits: limits}, task.Task{}, nil, 0.5, true},
+		{"over the maximum per task", &Quota{Limits: limits}, task.Task{Cpu: 3}, errLimitRange, 3, false},
+		{"over the cpu quota", &Quota{Cpu: 2}, task.Task{Cpu: 1.5}, ErrQuotaExceeded, 1.5, false},
+		{"over the task count", &Quota{Tasks: 1}, task.Task{}, ErrQuotaExceeded, 0, false},
+		{"inactive tasks do not count", &Quota{Tasks: 2}, task.Task{}, nil, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(t)
+			if tt.quota != nil {
+				_, err := m.SetQuota("team-a", tt.quota)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			// one active task of 1 cpu, one completed task and one in
+			// another namespace
+			for _, other := range []task.Task{
+				{ID: uuid.New(), Namespace: "team-a", State: task.Running, Cpu: 1},
+				{ID: uuid.New(), Namespace: "team-a", State: task.Completed, Cpu: 1},
+				{ID: uuid.New(), Namespace: "team-b", State: task.Running, Cpu: 4},
+			} {
+				other := other
+				m.TaskDb.Put(other.Key(), &other)
+			}
+
+			tk := tt.task
+			tk.ID = uuid.New()
+			tk.Name = "job"
+			tk.Namespace = "team-a"
+			tk.State = task.Scheduled
+			err := m.admitTask(&tk)
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Fatalf("admitTask() = %v", err)
+			case tt.wantErr == ErrQuotaExceeded && !errors.Is(err, ErrQuotaExceeded):
+				t.Fatalf("admitTask() = %v, want %v", err, ErrQuotaExceeded)
+			case tt.wantErr == errLimitRange && (err == nil || errors.Is(err, ErrQuotaExceeded)):
+				t.Fatalf("admitTask() = %v, want a limit range error", err)
+			}
+			if tk.Cpu != tt.wantCpu {
+				t.Errorf("cpu request = %g, want %g", tk.Cpu, tt.wantCpu)
+			}
+
+			result, err := m.TaskDb.Get(tk.Key())
+			if (err == nil) != tt.wantStore {
+				t.Fatalf("stored = %v, want %v", err == nil, tt.wantStore)
+			}
+			if err == nil && result.(*task.Task).State != task.Pending {
+				t.Errorf("stored as %v, want Pending", result.(*task.Task).State)
+			}
+		})
+	}
+}
+
+// errLimitRange stands for the errors of tasks over the maximum of their
+// limit range in TestAdmitTask.
+var errLimitRange = errors.New("limit range")
+
+func TestQuotaValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		quota   Quota
+		wantErr bool
+	}{
+		{"empty", Quota{}, false},
+		{"limits within each other", Quota{Cpu: 4, Limits: LimitRange{Default: Resources{Cpu: 1}, Max: Resources{Cpu: 2}}}, false},
+		{"default without a maximum", Quota{Limits: LimitRange{Default: Resources{Memory: 1 << 20}}}, false},
+		{"negative quota", Quota{Tasks: -1}, true},
+		{"negative default", Quota{Limits: LimitRange{Default: Resources{Disk: -1}}}, true},
+		{"default over the maximum", Quota{Limits: LimitRange{Default: Resources{Cpu: 3}, Max: Resources{Cpu: 2}}}, true},
+	}
+	for _, tt := range tests {
+		err := tt.quota.validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: validate() = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestAdmitTaskRejectsExistingTask(t *testing.T) {
+	tests := []struct {
+		name  string
+		state task.State
+	}{
+		{"running", task.Running},
+		{"completed", task.Completed},
+		{"pending", task.Pending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(t)
+			stored := &task.Task{ID: uuid.New(), Name: "job", Namespace: "team-a", State: tt.state}
+			m.TaskDb.Put(stored.Key(), stored)
+
+			again := task.Task{ID: stored.ID, Name: "job", Namespace: "team-a", State: task.Scheduled}
+			err := m.admitTask(&again)
+			if !errors.Is(err, ErrTaskExists) {
+				t.Fatalf("admitTask() = %v, want %v", err, ErrTaskExists)
+			}
+			result, err := m.TaskDb.Get(stored.Key())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := result.(*task.Task).State; got != tt.state {
+				t.Errorf("stored task is %v, want %v", got, tt.state)
+			}
+		})
+	}
+}
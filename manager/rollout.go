@@ -0,0 +1,312 @@
+package manager
+
+import (
+	"cube/task"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	StartFirst = "start-first"
+	StopFirst  = "stop-first"
+
+	FailurePause    = "pause"
+	FailureRollback = "rollback"
+)
+
+type UpdateConfig struct {
+	Parallelism    int
+	MaxSurge       int
+	MaxUnavailable int
+	Order          string
+	MonitorSeconds int
+	FailureAction  string
+}
+
+func (u *UpdateConfig) validate() error {
+	if u.Parallelism == 0 {
+		u.Parallelism = 1
+	}
+	if u.Order == "" {
+		u.Order = StartFirst
+	}
+	if u.FailureAction == "" {
+		u.FailureAction = FailurePause
+	}
+	if u.MaxSurge == 0 && u.MaxUnavailable == 0 {
+		u.MaxSurge = 1
+	}
+
+	if u.Parallelism < 0 || u.MaxSurge < 0 || u.MaxUnavailable < 0 || u.MonitorSeconds < 0 {
+		return errors.New("update settings must not be negative")
+	}
+	if u.Order != StartFirst && u.Order != StopFirst {
+		return fmt.Errorf("unknown update order %s", u.Order)
+	}
+	if u.FailureAction != FailurePause && u.FailureAction != FailureRollback {
+		return fmt.Errorf("unknown failure action %s", u.FailureAction)
+	}
+	return nil
+}
+
+type RolloutState int
+
+const (
+	RolloutUpdating RolloutState = iota
+	RolloutPaused
+	RollingBack
+	RolloutCompleted
+	RolloutCanary
+	RolloutPreview
+)
+
+type Rollout struct {
+	State        RolloutState
+	FromRevision int
+	ToRevision   int
+	StartTime    time.Time
+	FinishTime   time.Time
+	Message      string
+	Tasks        []uuid.UUID
+}
+
+func (s *Service) revision(n int) (ServiceRevision, bool) {
+	for _, r := range s.History {
+		if r.Revision == n {
+			return r, true
+		}
+	}
+	return ServiceRevision{}, false
+}
+
+func (s *Service) startRollout(state RolloutState, to ServiceRevision) {
+	log.Printf("[rollout] service %s moving from revision %d to %d", s.Name, s.Revision, to.Revision)
+	s.Rollout = &Rollout{
+		State:        state,
+		FromRevision: s.Revision,
+		ToRevision:   to.Revision,
+		StartTime:    time.Now().UTC(),
+	}
+	s.Spec = to.Spec
+	s.Revision = to.Revision
+	s.ActiveRevision = 0
+}
+
+// UpdateService records spec as a new revision of the service and starts
+// rolling the existing tasks over to it.
+func (m *Manager) UpdateService(namespace, name string, spec ServiceSpec, update *UpdateConfig, strategy *DeployStrategy) (*Service, error) {
+	err := spec.validate()
+	if err != nil {
+		return nil, err
+	}
+	_, err = m.schedulerFor(task.Task{Scheduler: spec.Scheduler})
+	if err != nil {
+		return nil, err
+	}
+	if update != nil {
+		err := update.validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if strategy != nil {
+		err := strategy.validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	m.serviceMu.Lock()
+	defer m.serviceMu.Unlock()
+	s, ok := m.Services[serviceKey(namespace, name)]
+	if !ok {
+		return nil, fmt.Errorf("service %s not found", name)
+	}
+	if update != nil {
+		s.Update = *update
+	}
+	if strategy != nil {
+		s.Strategy = *strategy
+	}
+
+	next := ServiceRevision{
+		Revision:  s.History[len(s.History)-1].Revision + 1,
+		Spec:      spec,
+		CreatedAt: time.Now().UTC(),
+	}
+	s.History = append(s.History, next)
+	switch s.Strategy.Type {
+	case StrategyCanary:
+		s.startRollout(RolloutCanary, next)
+	case StrategyBlueGreen:
+		s.startRollout(RolloutPreview, next)
+		s.ActiveRevision = s.Rollout.FromRevision
+	default:
+		s.startRollout(RolloutUpdating, next)
+	}
+	return s, nil
+}
+
+// RollbackService rolls the service back to the given revision, or to the
+// revision preceding the current one when revision is 0.
+func (m *Manager) RollbackService(namespace, name string, revision int) (*Service, error) {
+	m.serviceMu.Lock()
+	defer m.serviceMu.Unlock()
+	s, ok := m.Services[serviceKey(namespace, name)]
+	if !ok {
+		return nil, fmt.Errorf("service %s not found", name)
+	}
+	return s, m.rollbackService(s, revision)
+}
+
+func (m *Manager) rollbackService(s *Service, revision int) error {
+	if revision == 0 {
+		if s.Rollout != nil && s.Rollout.FromRevision != s.Revision {
+			revision = s.Rollout.FromRevision
+		} else {
+			for _, r := range s.History {
+				if r.Revision < s.Revision && r.Revision > revision {
+					revision = r.Revision
+				}
+			}
+		}
+	}
+	if revision == s.Revision {
+		return fmt.Errorf("service %s is already at revision %d", s.Name, revision)
+	}
+	target, ok := s.revision(revision)
+	if !ok {
+		return fmt.Errorf("service %s has no revision %d", s.Name, revision)
+	}
+	s.startRollout(RollingBack, target)
+	return nil
+}
+
+// ResumeService continues a rollout that was paused after a failure.
+func (m *Manager) ResumeService(namespace, name string) (*Service, error) {
+	m.serviceMu.Lock()
+	defer m.serviceMu.Unlock()
+	s, ok := m.Services[serviceKey(namespace, name)]
+	if !ok {
+		return nil, fmt.Errorf("service %s not found", name)
+	}
+	if s.Rollout == nil || s.Rollout.State != RolloutPaused {
+		return nil, fmt.Errorf("service %s has no paused rollout", s.Name)
+	}
+	s.Rollout.State = RolloutUpdating
+	s.Rollout.StartTime = time.Now().UTC()
+	s.Rollout.Tasks = nil
+	s.Rollout.Message = ""
+	return s, nil
+}
+
+// taskReady reports whether a task has been running for the monitor period
+// and passes its health check.
+func (m *Manager) taskReady(t *task.Task, monitor time.Duration) bool {
+	if t.State != task.Running || t.StartTime.IsZero() {
+		return false
+	}
+	if time.Since(t.StartTime) < monitor {
+		return false
+	}
+	if t.HealthCheck == "" {
+		return true
+	}
+	return m.checkTaskHealth(*t) == nil
+}
+
+func (m *Manager) rolloutFailed(s *Service, tasks []*task.Task) *task.Task {
+	for _, t := range tasks {
+		for _, id := range s.Rollout.Tasks {
+			if t.ID != id {
+				continue
+			}
+			if t.State == task.Failed || t.RestartCount > 0 {
+				return t
+			}
+		}
+	}
+	return nil
+}
+
+func imin(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+// stopBatch is how many of the old tasks a batch stops: no more than the
+// parallelism, and none that would leave fewer than replicas-MaxUnavailable
+// old and ready new tasks.
+func (u *UpdateConfig) stopBatch(replicas, old, ready int) int {
+	return imin(u.Parallelism, old, old+ready-(replicas-u.MaxUnavailable))
+}
+
+// startBatch is how many new tasks a batch starts: no more than the
+// parallelism, the replicas still missing, or what keeps the total within
+// replicas+MaxSurge.
+func (u *UpdateConfig) startBatch(replicas, old, fresh int) int {
+	return imin(u.Parallelism, replicas-fresh, replicas+u.MaxSurge-old-fresh)
+}
+
+// rollService moves a service one batch closer to its current revision.
+// A new batch is only started once every task of the previous batch is
+// ready, and no more than MaxSurge extra or MaxUnavailable missing replicas
+// are allowed at any point.
+func (m *Manager) rollService(s *Service, tasks []*task.Task, active []*task.Task) {
+	r := s.Rollout
+	u := s.Update
+
+	if t := m.rolloutFailed(s, tasks); t != nil {
+		r.Message = fmt.Sprintf("task %s of revision %d failed", t.ID, s.Revision)
+		log.Printf("[rollout] service %s: %s", s.Name, r.Message)
+		if r.State == RolloutUpdating && u.FailureAction == FailureRollback {
+			m.rollbackService(s, r.FromRevision)
+			return
+		}
+		r.State = RolloutPaused
+		return
+	}
+
+	old, fresh, ready := m.splitRevision(s, active, time.Duration(u.MonitorSeconds)*time.Second)
+
+	if len(old) == 0 && len(ready) >= s.Replicas {
+		r.State = RolloutCompleted
+		r.FinishTime = time.Now().UTC()
+		log.Printf("[rollout] service %s is now at revision %d", s.Name, s.Revision)
+		return
+	}
+	if len(fresh) > len(ready) {
+		log.Printf("[rollout] service %s waiting for %d task(s) of revision %d to become ready", s.Name, len(fresh)-len(ready), s.Revision)
+		return
+	}
+
+	stop := func() {
+		n := u.stopBatch(s.Replicas, len(old), len(ready))
+		if n > 0 {
+			old = old[m.stopServiceTasks(s, old, n):]
+		}
+	}
+	start := func() {
+		n := u.startBatch(s.Replicas, len(old), len(fresh))
+		for i := 0; i < n; i++ {
+			r.Tasks = append(r.Tasks, m.startServiceTask(s, s.current()))
+		}
+	}
+
+	if u.Order == StopFirst {
+		stop()
+		start()
+	} else {
+		start()
+		stop()
+	}
+}
@@ -0,0 +1,94 @@
+package manager
+
+import "testing"
+
+func TestUpdateConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  UpdateConfig
+		want    UpdateConfig
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			want: UpdateConfig{Parallelism: 1, MaxSurge: 1, Order: StartFirst, FailureAction: FailurePause},
+		},
+		{
+			name:   "unavailable replicas instead of a surge",
+			config: UpdateConfig{Parallelism: 2, MaxUnavailable: 1, Order: StopFirst, FailureAction: FailureRollback},
+			want:   UpdateConfig{Parallelism: 2, MaxUnavailable: 1, Order: StopFirst, FailureAction: FailureRollback},
+		},
+		{name: "negative parallelism", config: UpdateConfig{Parallelism: -1}, wantErr: true},
+		{name: "negative surge", config: UpdateConfig{MaxSurge: -1, MaxUnavailable: 1}, wantErr: true},
+		{name: "negative monitor period", config: UpdateConfig{MonitorSeconds: -5}, wantErr: true},
+		{name: "unknown order", config: UpdateConfig{Order: "random"}, wantErr: true},
+		{name: "unknown failure action", config: UpdateConfig{FailureAction: "ignore"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := tt.config
+			err := u.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validate() = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && u != tt.want {
+				t.Errorf("validate() filled in %+v, want %+v", u, tt.want)
+			}
+		})
+	}
+}
+
+// TestRolloutBatches replays a rollout in which every started task is
+// ready by the next pass, and checks that the batches respect the surge
+// and unavailability limits and replace every old task.
+func TestRolloutBatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		replicas int
+		config   UpdateConfig
+		passes   int
+	}{
+		{"one at a time with a surge", 3, UpdateConfig{}, 6},
+		{"stop first without a surge", 3, UpdateConfig{MaxUnavailable: 1, Order: StopFirst}, 3},
+		{"start first without a surge", 3, UpdateConfig{MaxUnavailable: 1}, 6},
+		{"parallel batches", 4, UpdateConfig{Parallelism: 2, MaxSurge: 2}, 4},
+		{"single replica allowed to go down", 1, UpdateConfig{MaxUnavailable: 1, Order: StopFirst}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := tt.config
+			err := u.validate()
+			if err != nil {
+				t.Fatal(err)
+			}
+			old, fresh, ready := tt.replicas, 0, 0
+			for pass := 1; ; pass++ {
+				ready = fresh
+				if old == 0 && ready >= tt.replicas {
+					if pass-1 != tt.passes {
+						t.Errorf("rollout took %d passes, want %d", pass-1, tt.passes)
+					}
+					return
+				}
+				if pass > 10*tt.replicas {
+					t.Fatalf("rollout stuck with %d old and %d new tasks", old, fresh)
+				}
+
+				if u.Order == StopFirst {
+					old -= u.stopBatch(tt.replicas, old, ready)
+					fresh += u.startBatch(tt.replicas, old, fresh)
+				} else {
+					fresh += u.startBatch(tt.replicas, old, fresh)
+					old -= u.stopBatch(tt.replicas, old, ready)
+				}
+
+				if old+fresh > tt.replicas+u.MaxSurge {
+					t.Errorf("pass %d: %d tasks, more than %d replicas and a surge of %d", pass, old+fresh, tt.replicas, u.MaxSurge)
+				}
+				if old+ready < tt.replicas-u.MaxUnavailable {
+					t.Errorf("pass %d: %d available tasks, fewer than %d replicas less %d unavailable", pass, old+ready, tt.replicas, u.MaxUnavailable)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package manager
+
+import (
+	"cube/config"
+	"cube/scheduler"
+	"cube/task"
+	"fmt"
+)
+
+// newSchedulers creates the built-in schedulers and the profiles of the
+// configuration, keyed by the name tasks select them with.
+func newSchedulers(c config.Manager) (map[string]scheduler.Scheduler, error) {
+	schedulers := map[string]scheduler.Scheduler{
+		"epvm":           &scheduler.Epvm{Name: "epvm"},
+		"roundrobin":     &scheduler.RoundRobin{Name: "roundrobin"},
+		"mostallocated":  &scheduler.MostAllocated{Name: "mostallocated"},
+		"leastallocated": &scheduler.LeastAllocated{Name: "leastallocated"},
+	}
+	for name, pc := range c.Profiles {
+		var scores []scheduler.ScoreWeight
+		for _, s := range pc.Scores {
+			scores = append(scores, scheduler.ScoreWeight{Plugin: s.Plugin, Weight: s.Weight})
+		}
+		p, err := scheduler.DefaultRegistry.Profile(name, pc.Filters, scores)
+		if err != nil {
+			return nil, err
+		}
+		schedulers[name] = p
+	}
+	if _, ok := schedulers[c.Scheduler]; !ok {
+		schedulers[c.Scheduler] = &scheduler.Epvm{Name: "wpvm"}
+	}
+	return schedulers, nil
+}
+
+// schedulerFor returns the scheduler or profile a task asks for, or the
+// default one.
+func (m *Manager) schedulerFor(t task.Task) (scheduler.Scheduler, error) {
+	if t.Scheduler == "" {
+		return m.Scheduler, nil
+	}
+	s, ok := m.schedulers[t.Scheduler]
+	if !ok {
+		return nil, fmt.Errorf("unknown scheduler %q", t.Scheduler)
+	}
+	return s, nil
+}
+
+func (m *Manager) schedulerName(t task.Task) string {
+	if t.Scheduler != "" {
+		return t.Scheduler
+	}
+	m.configMu.RLock()
+	defer m.configMu.RUnlock()
+	return m.Config.Scheduler
+}
+
+// maxSchedulingAttempts bounds the scheduling explanations kept on a task.
+const maxSchedulingAttempts = 5
+
+// recordAttempt keeps the explanation of a scheduling attempt on t. The
+// history is copied so copies of the task do not share it.
+func recordAttempt(t *task.Task, a task.SchedulingAttempt) {
+	attempts := append(append([]task.SchedulingAttempt(nil), t.Scheduling...), a)
+	if len(attempts) > maxSchedulingAttempts {
+		attempts = attempts[len(attempts)-maxSchedulingAttempts:]
+	}
+	t.Scheduling = attempts
+}
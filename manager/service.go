@@ -0,0 +1,372 @@
+package manager
+
+import (
+	"cube/task"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/google/uuid"
+)
+
+type ServiceSpec struct {
+	Image          string
+	Cpu            float64
+	Memory         int64
+	Disk           int64
+	ExposedPorts   nat.PortSet
+	PortBindings   map[string]string
+	HealthCheck    string
+	RestartPolicy  string
+	Labels         map[string]string
+	NodeSelector   map[string]string
+	Affinity       *task.Affinity
+	TopologySpread []task.SpreadConstraint
+	Tolerations    []task.Toleration
+	Scheduler      string
+	PriorityClass  string
+}
+
+func (s ServiceSpec) validate() error {
+	if s.Image == "" {
+		return errors.New("service image is required")
+	}
+	t := task.Task{Labels: s.Labels, NodeSelector: s.NodeSelector, Affinity: s.Affinity, TopologySpread: s.TopologySpread, Tolerations: s.Tolerations, PriorityClass: s.PriorityClass}
+	return t.ValidatePlacement()
+}
+
+type ServiceRevision struct {
+	Revision  int
+	Spec      ServiceSpec
+	CreatedAt time.Time
+}
+
+type Service struct {
+	ID             uuid.UUID
+	Name           string
+	Namespace      string
+	Replicas       int
+	Spec           ServiceSpec
+	Revision       int
+	ActiveRevision int
+	History        []ServiceRevision
+	Update         UpdateConfig
+	Strategy       DeployStrategy
+	Rollout        *Rollout
+	Autoscale      *AutoscaleConfig
+	Disruption     DisruptionBudget
+	LastScaleTime  time.Time
+	Events         []ServiceEvent
+
+	recommendations []recommendation
+}
+
+// serviceKey identifies a service across namespaces.
+func serviceKey(namespace, name string) string {
+	return task.NamespaceOf(namespace) + "/" + name
+}
+
+func (s *Service) key() string {
+	return serviceKey(s.Namespace, s.Name)
+}
+
+func (s *Service) current() ServiceRevision {
+	return ServiceRevision{Revision: s.Revision, Spec: s.Spec}
+}
+
+// Serving reports whether the task should receive traffic for the service.
+// Only the active revision serves while a blue-green deployment is in
+// progress, otherwise every running task does.
+func (s *Service) Serving(t *task.Task) bool {
+	if t.State != task.Running {
+		return false
+	}
+	return s.ActiveRevision == 0 || t.Revision == s.ActiveRevision
+}
+
+func (s *Service) newTask(rev ServiceRevision) task.Task {
+	id := uuid.New()
+	return task.Task{
+		ID:             id,
+		Name:           fmt.Sprintf("%s-%s", s.Name, id.String()[:8]),
+		Namespace:      s.Namespace,
+		State:          task.Scheduled,
+		Image:          rev.Spec.Image,
+		Cpu:            rev.Spec.Cpu,
+		Memory:         rev.Spec.Memory,
+		Disk:           rev.Spec.Disk,
+		ExposedPorts:   rev.Spec.ExposedPorts,
+		PortBindings:   rev.Spec.PortBindings,
+		HealthCheck:    rev.Spec.HealthCheck,
+		RestartPolicy:  rev.Spec.RestartPolicy,
+		Service:        s.Name,
+		Revision:       rev.Revision,
+		Labels:         rev.Spec.Labels,
+		NodeSelector:   rev.Spec.NodeSelector,
+		Affinity:       rev.Spec.Affinity,
+		TopologySpread: rev.Spec.TopologySpread,
+		Tolerations:    rev.Spec.Tolerations,
+		Scheduler:      rev.Spec.Scheduler,
+		PriorityClass:  rev.Spec.PriorityClass,
+	}
+}
+
+func isActive(t *task.Task) bool {
+	return t.State == task.Pending || t.State == task.Scheduled || t.State == task.Running || t.State == task.Lost
+}
+
+func (m *Manager) AddService(s *Service) error {
+	if s.Name == "" {
+		return errors.New("service name is required")
+	}
+	err := s.Spec.validate()
+	if err != nil {
+		return err
+	}
+	_, err = m.schedulerFor(task.Task{Scheduler: s.Spec.Scheduler})
+	if err != nil {
+		return err
+	}
+	if s.Replicas < 0 {
+		return errors.New("replicas must not be negative")
+	}
+	err = s.Update.validate()
+	if err != nil {
+		return err
+	}
+	err = s.Strategy.validate()
+	if err != nil {
+		return err
+	}
+	err = s.Disruption.validate()
+	if err != nil {
+		return err
+	}
+	if s.Autoscale != nil {
+		err = s.Autoscale.validate()
+		if err != nil {
+			return err
+		}
+		if s.Replicas < s.Autoscale.MinReplicas {
+			s.Replicas = s.Autoscale.MinReplicas
+		}
+		if s.Replicas > s.Autoscale.MaxReplicas {
+			s.Replicas = s.Autoscale.MaxReplicas
+		}
+	}
+
+	s.Namespace = task.NamespaceOf(s.Namespace)
+	m.serviceMu.Lock()
+	defer m.serviceMu.Unlock()
+	if _, ok := m.Services[s.key()]; ok {
+		return fmt.Errorf("service %s already exists in namespace %s", s.Name, s.Namespace)
+	}
+	s.ID = uuid.New()
+	s.Revision = 1
+	s.History = []ServiceRevision{{Revision: 1, Spec: s.Spec, CreatedAt: time.Now().UTC()}}
+	s.Rollout = nil
+	m.Services[s.key()] = s
+	return nil
+}
+
+// GetServices returns the services of a namespace.
+func (m *Manager) GetServices(namespace string) []*Service {
+	services := []*Service{}
+	for _, s := range m.allServices() {
+		if s.Namespace == namespace {
+			services = append(services, s)
+		}
+	}
+	return services
+}
+
+func (m *Manager) allServices() []*Service {
+	m.serviceMu.Lock()
+	defer m.serviceMu.Unlock()
+	services := []*Service{}
+	for _, s := range m.Services {
+		services = append(services, s)
+	}
+	return services
+}
+
+func (m *Manager) GetService(namespace, name string) (*Service, error) {
+	m.serviceMu.Lock()
+	defer m.serviceMu.Unlock()
+	s, ok := m.Services[serviceKey(namespace, name)]
+	if !ok {
+		return nil, fmt.Errorf("service %s not found", name)
+	}
+	return s, nil
+}
+
+func (m *Manager) ScaleService(namespace, name string, replicas int) error {
+	if replicas < 0 {
+		return errors.New("replicas must not be negative")
+	}
+	m.serviceMu.Lock()
+	defer m.serviceMu.Unlock()
+	s, ok := m.Services[serviceKey(namespace, name)]
+	if !ok {
+		return fmt.Errorf("service %s not found", name)
+	}
+	log.Printf("[service] scaling service %s from %d to %d replicas", name, s.Replicas, replicas)
+	s.recordEvent("Scaled", fmt.Sprintf("scaled from %d to %d replicas on request", s.Replicas, replicas))
+	s.Replicas = replicas
+	return nil
+}
+
+// RemoveService deletes the service and stops all of its active tasks.
+func (m *Manager) RemoveService(namespace, name string) error {
+	m.serviceMu.Lock()
+	s, ok := m.Services[serviceKey(namespace, name)]
+	delete(m.Services, serviceKey(namespace, name))
+	m.serviceMu.Unlock()
+	if !ok {
+		return fmt.Errorf("service %s not found", name)
+	}
+
+	for _, t := range m.serviceTasks(s) {
+		if !isActive(t) {
+			continue
+		}
+		err := m.terminateTask(t)
+		if err != nil {
+			log.Printf("[service] error stopping task %s of removed service %s: %v", t.ID, name, err)
+		}
+	}
+	return nil
+}
+
+func (m *Manager) serviceTasks(s *Service) []*task.Task {
+	var tasks []*task.Task
+	for _, t := range m.GetTasks() {
+		if t.Service == s.Name && t.InNamespace(s.Namespace) {
+			tasks = append(tasks, t)
+		}
+	}
+	return tasks
+}
+
+func (m *Manager) startServiceTask(s *Service, rev ServiceRevision) uuid.UUID {
+	t := s.newTask(rev)
+	// the task is persisted as Pending so it is counted as a replica while
+	// it waits in the queue
+	err := m.admitTask(&t)
+	if err != nil {
+		log.Printf("[service] unable to create a task for service %s: %v", s.Name, err)
+		// a task over the limit range of the namespace or one that could
+		// not be stored is rejected for another reason than the quota
+		eventType := "TaskRejected"
+		if errors.Is(err, ErrQuotaExceeded) {
+			eventType = "QuotaExceeded"
+		}
+		if n := len(s.Events); n == 0 || s.Events[n-1].Message != err.Error() {
+			s.recordEvent(eventType, err.Error())
+		}
+		return uuid.Nil
+	}
+	te := task.TaskEvent{
+		ID:        uuid.New(),
+		State:     task.Running,
+		Timestamp: time.Now(),
+		Task:      t,
+	}
+	m.AddTask(te)
+	log.Printf("[service] created task %s for service %s", t.ID, s.Name)
+	return t.ID
+}
+
+// reconcileService compares the desired replica count of the service to its
+// active tasks and starts or stops tasks to converge.
+func (m *Manager) reconcileService(s *Service) {
+	tasks := m.serviceTasks(s)
+	var active []*task.Task
+	for _, t := range tasks {
+		if isActive(t) {
+			active = append(active, t)
+		}
+	}
+
+	if s.Rollout != nil {
+		switch s.Rollout.State {
+		case RolloutUpdating, RollingBack:
+			m.rollService(s, tasks, active)
+			return
+		case RolloutCanary:
+			m.canaryService(s, tasks, active)
+			return
+		case RolloutPreview:
+			m.blueGreenService(s, tasks, active)
+			return
+		}
+	}
+
+	switch {
+	case len(active) < s.Replicas:
+		for i := len(active); i < s.Replicas; i++ {
+			m.startServiceTask(s, s.current())
+		}
+	case len(active) > s.Replicas:
+		m.stopServiceTasks(s, active, len(active)-s.Replicas)
+	}
+}
+
+// stopServiceTasks stops count of the given tasks, starting with the ones
+// that are the cheapest to get rid of: tasks that are not running yet and
+// tasks running an outdated revision.
+func (m *Manager) stopServiceTasks(s *Service, tasks []*task.Task, count int) int {
+	var victims []*task.Task
+	for _, t := range tasks {
+		if t.State != task.Running {
+			victims = append(victims, t)
+		}
+	}
+	for _, t := range tasks {
+		if t.State == task.Running && t.Revision != s.Revision {
+			victims = append(victims, t)
+		}
+	}
+	for _, t := range tasks {
+		if t.State == task.Running && t.Revision == s.Revision {
+			victims = append(victims, t)
+		}
+	}
+	if count > len(victims) {
+		count = len(victims)
+	}
+
+	stopped := 0
+	for _, t := range victims[:count] {
+		err := m.terminateTask(t)
+		if err != nil {
+			log.Printf("[service] error stopping task %s of service %s: %v", t.ID, s.Name, err)
+			continue
+		}
+		stopped++
+	}
+	return stopped
+}
+
+func (m *Manager) reconcileServices() {
+	for _, s := range m.allServices() {
+		m.serviceMu.Lock()
+		if _, ok := m.Services[s.key()]; ok {
+			m.reconcileService(s)
+		}
+		m.serviceMu.Unlock()
+	}
+}
+
+func (m *Manager) ReconcileServices() {
+	for {
+		log.Println("Reconciling services")
+		m.reconcileServices()
+		log.Println("Service reconciliation completed")
+		d := m.intervals().Reconcile.Duration
+		log.Printf("Sleeping for %v", d)
+		time.Sleep(d)
+	}
+}
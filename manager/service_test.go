@@ -0,0 +1,89 @@
+package manager
+
+import (
+	"cube/task"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestStartServiceTaskEvents(t *testing.T) {
+	tests := []struct {
+		name      string
+		quota     *Quota
+		wantEvent string
+	}{
+		{"admitted", nil, ""},
+		{"quota full", &Quota{Cpu: 1}, "QuotaExceeded"},
+		{"over the limit range", &Quota{Limits: LimitRange{Max: Resources{Cpu: 1}}}, "TaskRejected"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(t)
+			if tt.quota != nil {
+				_, err := m.SetQuota("team-a", tt.quota)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			s := &Service{Name: "web", Namespace: "team-a"}
+			id := m.startServiceTask(s, ServiceRevision{Revision: 1, Spec: ServiceSpec{Image: "web", Cpu: 2}})
+
+			if (id == uuid.Nil) != (tt.wantEvent != "") {
+				t.Errorf("startServiceTask() = %v", id)
+			}
+			var got string
+			if len(s.Events) > 0 {
+				got = s.Events[len(s.Events)-1].Type
+			}
+			if got != tt.wantEvent {
+				t.Errorf("last event %q, want %q", got, tt.wantEvent)
+			}
+		})
+	}
+}
+
+func TestReconcileWithoutWorkersKeepsTasksBounded(t *testing.T) {
+	tests := []struct {
+		name     string
+		replicas int
+		workers  int
+	}{
+		{"no workers", 2, 0},
+		{"no worker with room", 3, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(t)
+			for i := 0; i < tt.workers; i++ {
+				registerWorker(t, m, fmt.Sprintf("worker-%d:5556", i))
+			}
+			s := &Service{Name: "web", Replicas: tt.replicas, Spec: ServiceSpec{Image: "web", Cpu: 8}}
+			err := m.AddService(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for pass := 0; pass < 5; pass++ {
+				m.reconcileServices()
+				for i := 0; i < tt.replicas; i++ {
+					m.SendWork()
+				}
+			}
+
+			tasks := m.serviceTasks(s)
+			if len(tasks) != tt.replicas {
+				t.Fatalf("service has %d tasks after 5 passes, want %d", len(tasks), tt.replicas)
+			}
+			for _, tk := range tasks {
+				if tk.State != task.Pending {
+					t.Errorf("task %s is %v, want pending", tk.ID, tk.State)
+				}
+				if len(tk.Scheduling) == 0 {
+					t.Errorf("task %s records no scheduling attempt", tk.ID)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package manager
+
+import (
+	"cube/node"
+	"cube/task"
+	"fmt"
+	"log"
+)
+
+// AddTaint adds a taint to a node, replacing a taint with the same key and
+// effect. Tasks that do not tolerate a NoExecute taint are evicted right
+// away.
+func (m *Manager) AddTaint(name string, taint node.Taint) (node.Node, error) {
+	err := taint.Validate()
+	if err != nil {
+		return node.Node{}, err
+	}
+
+	m.nodeMu.Lock()
+	var n *node.Node
+	for _, wn := range m.WorkerNodes {
+		if wn.Name == name {
+			n = wn
+		}
+	}
+	if n == nil {
+		m.nodeMu.Unlock()
+		return node.Node{}, fmt.Errorf("%w %s", ErrUnknownNode, name)
+	}
+	var taints []node.Taint
+	for _, t := range n.Taints {
+		if t.Key != taint.Key || t.Effect != taint.Effect {
+			taints = append(taints, t)
+		}
+	}
+	n.Taints = append(taints, taint)
+	result := *n
+	m.nodeMu.Unlock()
+
+	log.Printf("[manager] tainted node %s with %v", name, taint)
+	if taint.Effect == node.NoExecute {
+		m.evictUntolerated(name, []node.Taint{taint})
+	}
+	return result, nil
+}
+
+// RemoveTaint removes the taints with the given key from a node. An empty
+// effect removes the key for every effect.
+func (m *Manager) RemoveTaint(name, key, effect string) (node.Node, error) {
+	m.nodeMu.Lock()
+	defer m.nodeMu.Unlock()
+	for _, n := range m.WorkerNodes {
+		if n.Name != name {
+			continue
+		}
+		var taints []node.Taint
+		for _, t := range n.Taints {
+			if t.Key != key || (effect != "" && t.Effect != effect) {
+				taints = append(taints, t)
+			}
+		}
+		n.Taints = taints
+		log.Printf("[manager] removed taint %s from node %s", key, name)
+		return *n, nil
+	}
+	return node.Node{}, fmt.Errorf("%w %s", ErrUnknownNode, name)
+}
+
+// untolerated returns the first of the taints t does not tolerate.
+func untolerated(t *task.Task, taints []node.Taint) (node.Taint, bool) {
+	for _, taint := range taints {
+		if !t.Tolerates(taint.Key, taint.Value, taint.Effect) {
+			return taint, true
+		}
+	}
+	return node.Taint{}, false
+}
+
+// evictUntolerated stops the tasks on a node that do not tolerate one of
+// the given NoExecute taints. Unlike a drain this ignores disruption
+// budgets: service tasks are replaced by the reconciler and other tasks
+// are rescheduled like lost ones.
+func (m *Manager) evictUntolerated(worker string, taints []node.Taint) {
+	for _, t := range m.nodeTasks(worker) {
+		taint, ok := untolerated(t, taints)
+		if !ok {
+			continue
+		}
+		if t.Service != "" {
+			if s, err := m.GetService(t.Namespace, t.Service); err == nil {
+				err = m.terminateTask(t)
+				if err != nil {
+					log.Printf("[manager] error evicting task %s from node %s: %v", t.ID, worker, err)
+					continue
+				}
+				m.serviceMu.Lock()
+				s.recordEvent("Evicted", fmt.Sprintf("evicted task %s from node %s, taint %v is not tolerated", t.ID, worker, taint))
+				m.serviceMu.Unlock()
+				log.Printf("[manager] evicted task %s from node %s, taint %v is not tolerated", t.ID, worker, taint)
+				continue
+			}
+		}
+		err := m.stopTask(worker, t.ID.String())
+		if err != nil {
+			log.Printf("[manager] error evicting task %s from node %s: %v", t.ID, worker, err)
+			continue
+		}
+		m.loseTask(worker, t)
+		log.Printf("[manager] evicted task %s from node %s, taint %v is not tolerated", t.ID, worker, taint)
+	}
+}
+
+// enforceTaints evicts tasks from nodes whose NoExecute taints they do not
+// tolerate, which covers taints that arrived with a registration.
+func (m *Manager) enforceTaints() {
+	noExecute := make(map[string][]node.Taint)
+	m.nodeMu.RLock()
+	for _, n := range m.WorkerNodes {
+		for _, t := range n.Taints {
+			if t.Effect == node.NoExecute {
+				noExecute[n.Name] = append(noExecute[n.Name], t)
+			}
+		}
+	}
+	m.nodeMu.RUnlock()
+
+	for name, taints := range noExecute {
+		m.evictUntolerated(name, taints)
+	}
+}
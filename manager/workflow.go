@@ -0,0 +1,321 @@
+package manager
+
+import (
+	"cube/task"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type WorkflowState int
+
+const (
+	WorkflowRunning WorkflowState = iota
+	WorkflowCompleted
+	WorkflowFailed
+)
+
+type WorkflowNodeState int
+
+const (
+	NodeWaiting WorkflowNodeState = iota
+	NodeReleased
+	NodeCompleted
+	NodeFailed
+	NodeSkipped
+)
+
+// WorkflowNode is a task of a workflow. TaskID is the task of the latest
+// attempt, TaskIDs holds the tasks of every attempt. Reason says why a node
+// that is ready is still waiting or why it failed before its task started.
+type WorkflowNode struct {
+	Name      string
+	Task      task.Task
+	DependsOn []string
+	Retries   int
+	Attempts  int
+	TaskID    uuid.UUID
+	TaskIDs   []uuid.UUID
+	State     WorkflowNodeState
+	Reason    string
+}
+
+type Workflow struct {
+	ID         uuid.UUID
+	Name       string
+	Namespace  string
+	State      WorkflowState
+	Nodes      []*WorkflowNode
+	StartTime  time.Time
+	FinishTime time.Time
+}
+
+func (wf *Workflow) node(name string) *WorkflowNode {
+	for _, n := range wf.Nodes {
+		if n.Name == name {
+			return n
+		}
+	}
+	return nil
+}
+
+// validate checks that node names are unique, that every dependency refers
+// to a node of the workflow and that the dependencies form a DAG.
+func (wf *Workflow) validate() error {
+	if len(wf.Nodes) == 0 {
+		return errors.New("workflow has no nodes")
+	}
+	inDegree := make(map[string]int)
+	for _, n := range wf.Nodes {
+		if n.Name == "" {
+			return errors.New("workflow node without a name")
+		}
+		if _, ok := inDegree[n.Name]; ok {
+			return fmt.Errorf("duplicate workflow node %s", n.Name)
+		}
+		inDegree[n.Name] = 0
+	}
+	for _, n := range wf.Nodes {
+		for _, dep := range n.DependsOn {
+			if _, ok := inDegree[dep]; !ok {
+				return fmt.Errorf("node %s depends on unknown node %s", n.Name, dep)
+			}
+			inDegree[n.Name]++
+		}
+	}
+
+	var ready []string
+	for name, d := range inDegree {
+		if d == 0 {
+			ready = append(ready, name)
+		}
+	}
+	visited := 0
+	for len(ready) > 0 {
+		name := ready[0]
+		ready = ready[1:]
+		visited++
+		for _, n := range wf.Nodes {
+			for _, dep := range n.DependsOn {
+				if dep != name {
+					continue
+				}
+				inDegree[n.Name]--
+				if inDegree[n.Name] == 0 {
+					ready = append(ready, n.Name)
+				}
+			}
+		}
+	}
+	if visited != len(wf.Nodes) {
+		return errors.New("workflow dependencies contain a cycle")
+	}
+	return nil
+}
+
+func (m *Manager) AddWorkflow(wf *Workflow) error {
+	err := wf.validate()
+	if err != nil {
+		return err
+	}
+	wf.Namespace = task.NamespaceOf(wf.Namespace)
+	wf.ID = uuid.New()
+	wf.State = WorkflowRunning
+	wf.StartTime = time.Now().UTC()
+	for _, n := range wf.Nodes {
+		n.State = NodeWaiting
+		n.Attempts = 0
+		n.TaskID = uuid.Nil
+		n.TaskIDs = nil
+		n.Reason = ""
+	}
+
+	m.workflowMu.Lock()
+	defer m.workflowMu.Unlock()
+	m.Workflows[wf.ID] = wf
+	return nil
+}
+
+func (m *Manager) GetWorkflows(namespace string) []*Workflow {
+	m.workflowMu.Lock()
+	defer m.workflowMu.Unlock()
+	workflows := []*Workflow{}
+	for _, wf := range m.Workflows {
+		if wf.Namespace == namespace {
+			workflows = append(workflows, wf)
+		}
+	}
+	return workflows
+}
+
+func (m *Manager) GetWorkflow(namespace string, id uuid.UUID) (*Workflow, error) {
+	m.workflowMu.Lock()
+	defer m.workflowMu.Unlock()
+	wf, ok := m.Workflows[id]
+	if !ok || wf.Namespace != namespace {
+		return nil, fmt.Errorf("workflow %s not found", id)
+	}
+	return wf, nil
+}
+
+// isWorkflowTask reports whether the task was created by a workflow, in
+// which case retries are driven by the workflow instead of health checks.
+// Tasks of earlier attempts count too.
+func (m *Manager) isWorkflowTask(id uuid.UUID) bool {
+	m.workflowMu.Lock()
+	defer m.workflowMu.Unlock()
+	for _, wf := range m.Workflows {
+		for _, n := range wf.Nodes {
+			for _, taskID := range n.TaskIDs {
+				if taskID == id {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// releaseNode starts the task of a node. A node the quota of its namespace
+// has no room for keeps waiting, a node its limit range rejects fails.
+func (m *Manager) releaseNode(wf *Workflow, n *WorkflowNode) {
+	t := n.Task
+	t.ID = uuid.New()
+	t.Namespace = wf.Namespace
+	t.State = task.Scheduled
+	if t.Name == "" {
+		t.Name = fmt.Sprintf("%s-%s", wf.Name, n.Name)
+	}
+	if n.Attempts > 0 {
+		t.Name = fmt.Sprintf("%s-retry-%d", t.Name, n.Attempts)
+	}
+
+	err := m.admitTask(&t)
+	if err != nil {
+		if err.Error() != n.Reason {
+			log.Printf("[workflow] unable to release node %s of workflow %s: %v", n.Name, wf.ID, err)
+		}
+		n.Reason = err.Error()
+		if errors.Is(err, ErrQuotaExceeded) {
+			n.State = NodeWaiting
+		} else {
+			n.State = NodeFailed
+		}
+		return
+	}
+
+	te := task.TaskEvent{
+		ID:        uuid.New(),
+		State:     task.Running,
+		Timestamp: time.Now(),
+		Task:      t,
+	}
+	n.TaskID = t.ID
+	n.TaskIDs = append(n.TaskIDs, t.ID)
+	n.State = NodeReleased
+	n.Reason = ""
+	m.AddTask(te)
+	log.Printf("[workflow] released node %s of workflow %s as task %s", n.Name, wf.ID, t.ID)
+}
+
+func (m *Manager) updateNode(wf *Workflow, n *WorkflowNode) {
+	switch n.State {
+	case NodeReleased:
+		result, err := m.TaskDb.Get(task.Key(wf.Namespace, n.TaskID))
+		if err != nil {
+			// the task is still sitting in the pending queue
+			return
+		}
+		t := result.(*task.Task)
+		switch t.State {
+		case task.Completed:
+			n.State = NodeCompleted
+		case task.Failed:
+			if n.Attempts < n.Retries {
+				n.Attempts++
+				log.Printf("[workflow] node %s of workflow %s failed, retrying (%d/%d)", n.Name, wf.ID, n.Attempts, n.Retries)
+				m.releaseNode(wf, n)
+				return
+			}
+			n.State = NodeFailed
+		}
+	case NodeWaiting:
+		ready := true
+		for _, dep := range n.DependsOn {
+			switch wf.node(dep).State {
+			case NodeFailed, NodeSkipped:
+				log.Printf("[workflow] skipping node %s of workflow %s: upstream node %s did not complete", n.Name, wf.ID, dep)
+				n.State = NodeSkipped
+				return
+			case NodeCompleted:
+			default:
+				ready = false
+			}
+		}
+		if ready {
+			m.releaseNode(wf, n)
+		}
+	}
+}
+
+func (m *Manager) updateWorkflows() {
+	m.workflowMu.Lock()
+	var running []*Workflow
+	for _, wf := range m.Workflows {
+		if wf.State == WorkflowRunning {
+			running = append(running, wf)
+		}
+	}
+	m.workflowMu.Unlock()
+
+	for _, wf := range running {
+		m.workflowMu.Lock()
+		// nodes are visited until nothing changes so that a completed
+		// node releases its dependents in the same pass
+		for changed := true; changed; {
+			changed = false
+			for _, n := range wf.Nodes {
+				before := n.State
+				m.updateNode(wf, n)
+				if n.State != before && n.State != NodeReleased {
+					changed = true
+				}
+			}
+		}
+
+		done := true
+		failed := false
+		for _, n := range wf.Nodes {
+			switch n.State {
+			case NodeWaiting, NodeReleased:
+				done = false
+			case NodeFailed, NodeSkipped:
+				failed = true
+			}
+		}
+		if done {
+			wf.FinishTime = time.Now().UTC()
+			if failed {
+				wf.State = WorkflowFailed
+			} else {
+				wf.State = WorkflowCompleted
+			}
+			log.Printf("[workflow] workflow %s finished in state %v", wf.ID, wf.State)
+		}
+		m.workflowMu.Unlock()
+	}
+}
+
+func (m *Manager) ProcessWorkflows() {
+	for {
+		log.Println("Checking workflows for nodes to release")
+		m.updateWorkflows()
+		log.Println("Workflow checks completed")
+		d := m.intervals().Workflows.Duration
+		log.Printf("Sleeping for %v", d)
+		time.Sleep(d)
+	}
+}
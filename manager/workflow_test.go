@@ -0,0 +1,134 @@
+package manager
+
+import (
+	"cube/task"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestReleaseNodeAdmission(t *testing.T) {
+	tests := []struct {
+		name       string
+		quota      *Quota
+		wantState  WorkflowNodeState
+		wantReason bool
+	}{
+		{"no quota", nil, NodeReleased, false},
+		{"quota full", &Quota{Tasks: 1}, NodeWaiting, true},
+		{"over the limit range", &Quota{Limits: LimitRange{Max: Resources{Cpu: 0.5}}}, NodeFailed, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(t)
+			if tt.quota != nil {
+				_, err := m.SetQuota("team-a", tt.quota)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			running := &task.Task{ID: uuid.New(), Name: "other", Namespace: "team-a", State: task.Running}
+			m.TaskDb.Put(running.Key(), running)
+
+			wf := &Workflow{Name: "build", Namespace: "team-a", Nodes: []*WorkflowNode{{Name: "compile", Task: task.Task{Cpu: 1}}}}
+			err := m.AddWorkflow(wf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m.updateWorkflows()
+
+			n := wf.Nodes[0]
+			if n.State != tt.wantState || (n.Reason != "") != tt.wantReason {
+				t.Errorf("node is %v with reason %q, want %v with reason %v", n.State, n.Reason, tt.wantState, tt.wantReason)
+			}
+			wantPending := 0
+			if tt.wantState == NodeReleased {
+				wantPending = 1
+			}
+			if m.Pending.Len() != wantPending {
+				t.Errorf("%d tasks pending, want %d", m.Pending.Len(), wantPending)
+			}
+		})
+	}
+}
+
+func TestWorkflowValidate(t *testing.T) {
+	node := func(name string, deps ...string) *WorkflowNode {
+		return &WorkflowNode{Name: name, DependsOn: deps}
+	}
+	tests := []struct {
+		name    string
+		nodes   []*WorkflowNode
+		wantErr string
+	}{
+		{"single node", []*WorkflowNode{node("a")}, ""},
+		{"diamond", []*WorkflowNode{node("a"), node("b", "a"), node("c", "a"), node("d", "b", "c")}, ""},
+		{"listed before its dependency", []*WorkflowNode{node("b", "a"), node("a")}, ""},
+		{"no nodes", nil, "workflow has no nodes"},
+		{"unnamed node", []*WorkflowNode{node("")}, "workflow node without a name"},
+		{"duplicate node", []*WorkflowNode{node("a"), node("a")}, "duplicate workflow node a"},
+		{"unknown dependency", []*WorkflowNode{node("a", "z")}, "node a depends on unknown node z"},
+		{"self dependency", []*WorkflowNode{node("a", "a")}, "workflow dependencies contain a cycle"},
+		{"cycle", []*WorkflowNode{node("a", "c"), node("b", "a"), node("c", "b")}, "workflow dependencies contain a cycle"},
+		{"cycle behind a root", []*WorkflowNode{node("root"), node("a", "root", "b"), node("b", "a")}, "workflow dependencies contain a cycle"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wf := &Workflow{Nodes: tt.nodes}
+			err := wf.validate()
+			var got string
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.wantErr {
+				t.Errorf("validate() = %q, want %q", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIsWorkflowTaskAcrossRetries(t *testing.T) {
+	m := newTestManager(t)
+	wf := &Workflow{Name: "build", Nodes: []*WorkflowNode{{Name: "compile", Retries: 2}}}
+	err := m.AddWorkflow(wf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.updateWorkflows()
+
+	n := wf.Nodes[0]
+	first := n.TaskID
+	failed := &task.Task{ID: first, Name: "build-compile", Namespace: wf.Namespace, State: task.Failed}
+	m.TaskDb.Put(failed.Key(), failed)
+	m.assignTask("worker-1", first)
+	m.updateWorkflows()
+	if n.Attempts != 1 || n.TaskID == first {
+		t.Fatalf("node is on attempt %d with task %s, want a second attempt", n.Attempts, n.TaskID)
+	}
+
+	tests := []struct {
+		name string
+		id   uuid.UUID
+		want bool
+	}{
+		{"first attempt", first, true},
+		{"second attempt", n.TaskID, true},
+		{"other task", uuid.New(), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := m.isWorkflowTask(tt.id); got != tt.want {
+				t.Errorf("isWorkflowTask() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	m.doHealthChecks()
+	result, err := m.TaskDb.Get(failed.Key())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := result.(*task.Task).RestartCount; got != 0 {
+		t.Errorf("failed task of the first attempt restarted %d times, want 0", got)
+	}
+}
@@ -9,26 +9,128 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 )
 
+const (
+	NoSchedule       = "NoSchedule"
+	PreferNoSchedule = "PreferNoSchedule"
+	NoExecute        = "NoExecute"
+)
+
+// Taint repels tasks that do not tolerate it. NoSchedule keeps new tasks
+// away, PreferNoSchedule only avoids the node if possible and NoExecute also
+// evicts tasks already running on it.
+type Taint struct {
+	Key    string
+	Value  string
+	Effect string
+}
+
+func (t Taint) String() string {
+	if t.Value == "" {
+		return fmt.Sprintf("%s:%s", t.Key, t.Effect)
+	}
+	return fmt.Sprintf("%s=%s:%s", t.Key, t.Value, t.Effect)
+}
+
+// ParseTaint parses a taint written as key=value:Effect or key:Effect.
+func ParseTaint(s string) (Taint, error) {
+	kv, effect, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if !ok {
+		return Taint{}, fmt.Errorf("taint %q has no effect", s)
+	}
+	key, value, _ := strings.Cut(kv, "=")
+	t := Taint{Key: key, Value: value, Effect: effect}
+	return t, t.Validate()
+}
+
+func (t Taint) Validate() error {
+	if t.Key == "" {
+		return errors.New("taint without a key")
+	}
+	switch t.Effect {
+	case NoSchedule, PreferNoSchedule, NoExecute:
+		return nil
+	}
+	return fmt.Errorf("unknown taint effect %q", t.Effect)
+}
+
+type Status int
+
+const (
+	Unknown Status = iota
+	Ready
+	NotReady
+)
+
+func (s Status) String() string {
+	switch s {
+	case Ready:
+		return "Ready"
+	case NotReady:
+		return "NotReady"
+	}
+	return "Unknown"
+}
+
+// Node is a worker as seen by the manager. The Allocated fields hold the
+// requests of the active tasks assigned to the node, in the units of the
+// capacity fields, and PortsAllocated the host ports they bind. A capacity
+// of zero means the worker has not reported it yet.
 type Node struct {
 	Name            string
+	WorkerName      string
 	Ip              string
 	Api             string
+	Cpu             float64
+	CpuAllocated    float64
 	Memory          int64
 	MemoryAllocated int64
 	Disk            int64
 	DiskAllocated   int64
+	PortsAllocated  []string
 	Stats           stats.Stats
 	Role            string
 	TaskCount       int
+	Labels          map[string]string
+	Status          Status
+	LastHeartbeat   time.Time
+	Unschedulable   bool
+	Taints          []Taint
+	Tasks           []TaskRef
+}
+
+// TaskRef identifies a task assigned to a node for the inter-task affinity
+// and image locality rules of the scheduler.
+type TaskRef struct {
+	ID      string
+	Name    string
+	Service string
+	Image   string
+	Labels  map[string]string
+}
+
+// Registration is what a worker announces to the manager when it joins the
+// cluster. Memory is in KB and disk in bytes, like the capacity fields of
+// Node.
+type Registration struct {
+	Name    string
+	Address string
+	Cpu     float64
+	Memory  int64
+	Disk    int64
+	Labels  map[string]string
+	Taints  []Taint
 }
 
 func NewNode(name string, api string, role string) *Node {
 	return &Node{
-		Name: name,
-		Api:  api,
-		Role: role,
+		Name:   name,
+		Api:    api,
+		Role:   role,
+		Labels: make(map[string]string),
 	}
 }
 
@@ -66,6 +168,9 @@ func (n *Node) GetStats() (*stats.Stats, error) {
 
 	n.Memory = int64(stats.MemTotalKb())
 	n.Disk = int64(stats.DiskTotal())
+	if stats.CpuCount > 0 {
+		n.Cpu = float64(stats.CpuCount)
+	}
 	n.Stats = stats
 
 	return &n.Stats, nil
@@ -0,0 +1,244 @@
+package proxy
+
+import (
+	"cube/discovery"
+	"cube/task"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	RoundRobin       = "roundrobin"
+	LeastConnections = "leastconn"
+
+	// how long an endpoint is skipped after a request to it failed
+	unhealthyPeriod = 30 * time.Second
+)
+
+// Rule routes matching requests to a service of the rule's namespace.
+// Rule names are unique across namespaces.
+type Rule struct {
+	Name          string
+	Namespace     string
+	Host          string
+	PathPrefix    string
+	Service       string
+	ContainerPort string
+	Balancer      string
+}
+
+func (r *Rule) validate() error {
+	if r.Name == "" {
+		return errors.New("ingress rule name is required")
+	}
+	if r.Service == "" {
+		return errors.New("ingress rule service is required")
+	}
+	r.Namespace = task.NamespaceOf(r.Namespace)
+	if r.PathPrefix == "" {
+		r.PathPrefix = "/"
+	}
+	if !strings.HasPrefix(r.PathPrefix, "/") {
+		return fmt.Errorf("path prefix %s must start with /", r.PathPrefix)
+	}
+	if r.Balancer == "" {
+		r.Balancer = RoundRobin
+	}
+	if r.Balancer != RoundRobin && r.Balancer != LeastConnections {
+		return fmt.Errorf("unknown balancer %s", r.Balancer)
+	}
+	return nil
+}
+
+func (r *Rule) matches(host string, path string) bool {
+	if r.Host != "" && !strings.EqualFold(r.Host, host) {
+		return false
+	}
+	return strings.HasPrefix(path, r.PathPrefix)
+}
+
+func endpointAddress(e discovery.Endpoint) string {
+	return net.JoinHostPort(e.Host, fmt.Sprintf("%d", e.Port))
+}
+
+// HTTPProxy routes requests by host header and path prefix to the ready
+// endpoints of a service found in the registry.
+type HTTPProxy struct {
+	Address  string
+	Registry *discovery.Registry
+
+	mu        sync.Mutex
+	rules     map[string]*Rule
+	next      map[string]int
+	active    map[string]int
+	unhealthy map[string]time.Time
+}
+
+func NewHTTPProxy(address string, registry *discovery.Registry) *HTTPProxy {
+	return &HTTPProxy{
+		Address:   address,
+		Registry:  registry,
+		rules:     make(map[string]*Rule),
+		next:      make(map[string]int),
+		active:    make(map[string]int),
+		unhealthy: make(map[string]time.Time),
+	}
+}
+
+// SetRule adds the rule, replacing any rule with the same name in its
+// namespace. Defaults are filled into r.
+func (p *HTTPProxy) SetRule(r *Rule) error {
+	err := r.validate()
+	if err != nil {
+		return err
+	}
+	rule := *r
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if old, ok := p.rules[r.Name]; ok && old.Namespace != r.Namespace {
+		return fmt.Errorf("ingress rule %s belongs to namespace %s", r.Name, old.Namespace)
+	}
+	p.rules[r.Name] = &rule
+	return nil
+}
+
+func (p *HTTPProxy) DeleteRule(namespace, name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if r, ok := p.rules[name]; !ok || r.Namespace != task.NamespaceOf(namespace) {
+		return fmt.Errorf("ingress rule %s not found", name)
+	}
+	delete(p.rules, name)
+	delete(p.next, name)
+	return nil
+}
+
+// Rules returns the rules of a namespace.
+func (p *HTTPProxy) Rules(namespace string) []Rule {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	rules := []Rule{}
+	for _, r := range p.rules {
+		if r.Namespace == task.NamespaceOf(namespace) {
+			rules = append(rules, *r)
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+	return rules
+}
+
+// match returns the rule with the longest path prefix matching the request,
+// preferring rules that name the host explicitly.
+func (p *HTTPProxy) match(req *http.Request) *Rule {
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var best *Rule
+	for _, r := range p.rules {
+		if !r.matches(host, req.URL.Path) {
+			continue
+		}
+		if best == nil ||
+			len(r.PathPrefix) > len(best.PathPrefix) ||
+			(len(r.PathPrefix) == len(best.PathPrefix) && r.Host != "" && best.Host == "") {
+			best = r
+		}
+	}
+	return best
+}
+
+func (p *HTTPProxy) pick(r *Rule) (string, error) {
+	var candidates []string
+	now := time.Now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, e := range p.Registry.LookupIn(r.Namespace, r.Service) {
+		if r.ContainerPort != "" && e.ContainerPort != r.ContainerPort {
+			continue
+		}
+		addr := endpointAddress(e)
+		if until, ok := p.unhealthy[addr]; ok && now.Before(until) {
+			continue
+		}
+		candidates = append(candidates, addr)
+	}
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no healthy endpoints for service %s", r.Service)
+	}
+
+	var addr string
+	switch r.Balancer {
+	case LeastConnections:
+		addr = candidates[0]
+		for _, c := range candidates[1:] {
+			if p.active[c] < p.active[addr] {
+				addr = c
+			}
+		}
+	default:
+		i := p.next[r.Name] % len(candidates)
+		p.next[r.Name] = i + 1
+		addr = candidates[i]
+	}
+	p.active[addr]++
+	return addr, nil
+}
+
+func (p *HTTPProxy) release(addr string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.active[addr]--
+	if p.active[addr] <= 0 {
+		delete(p.active, addr)
+	}
+}
+
+func (p *HTTPProxy) markUnhealthy(addr string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.unhealthy[addr] = time.Now().Add(unhealthyPeriod)
+}
+
+func (p *HTTPProxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r := p.match(req)
+	if r == nil {
+		http.Error(w, "no ingress rule matches the request", http.StatusNotFound)
+		return
+	}
+
+	addr, err := p.pick(r)
+	if err != nil {
+		log.Printf("[ingress] %v", err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer p.release(addr)
+
+	target := &url.URL{Scheme: "http", Host: addr}
+	rp := httputil.NewSingleHostReverseProxy(target)
+	rp.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
+		log.Printf("[ingress] error proxying to %s for rule %s, marking endpoint unhealthy: %v", addr, r.Name, err)
+		p.markUnhealthy(addr)
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	rp.ServeHTTP(w, req)
+}
+
+func (p *HTTPProxy) ListenAndServe() error {
+	log.Printf("[ingress] listening on %s", p.Address)
+	return http.ListenAndServe(p.Address, p)
+}
@@ -0,0 +1,49 @@
+package proxy
+
+import (
+	"cube/discovery"
+	"testing"
+)
+
+func TestRulesByNamespace(t *testing.T) {
+	p := NewHTTPProxy("", discovery.NewRegistry())
+	for _, r := range []Rule{
+		{Name: "web", Service: "web"},
+		{Name: "api", Namespace: "team-a", Service: "api"},
+	} {
+		err := p.SetRule(&r)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		rule    Rule
+		wantErr bool
+	}{
+		{"replace in the same namespace", Rule{Name: "api", Namespace: "team-a", Service: "api-v2"}, false},
+		{"name taken by another namespace", Rule{Name: "web", Namespace: "team-a", Service: "web"}, true},
+		{"new rule", Rule{Name: "admin", Namespace: "team-a", Service: "admin"}, false},
+	}
+	for _, tt := range tests {
+		err := p.SetRule(&tt.rule)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: SetRule() error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	counts := map[string]int{"": 1, "default": 1, "team-a": 2, "team-b": 0}
+	for namespace, want := range counts {
+		if got := len(p.Rules(namespace)); got != want {
+			t.Errorf("Rules(%q) has %d rules, want %d", namespace, got, want)
+		}
+	}
+
+	if err := p.DeleteRule("team-a", "web"); err == nil {
+		t.Error("deleted the rule of another namespace")
+	}
+	if err := p.DeleteRule("", "web"); err != nil {
+		t.Errorf("DeleteRule() = %v", err)
+	}
+}
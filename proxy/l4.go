@@ -0,0 +1,427 @@
+package proxy
+
+import (
+	"cube/discovery"
+	"cube/task"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDrainSeconds = 30
+	udpSessionTimeout   = 60 * time.Second
+)
+
+// Listener forwards a port of the manager to a service of the listener's
+// namespace. Listener names are unique across namespaces.
+type Listener struct {
+	Name          string
+	Namespace     string
+	Service       string
+	Protocol      string
+	ListenPort    int
+	ContainerPort string
+	DrainSeconds  int
+}
+
+func (l *Listener) validate() error {
+	if l.Service == "" {
+		return errors.New("load balancer service is required")
+	}
+	if l.Name == "" {
+		l.Name = l.Service
+	}
+	l.Namespace = task.NamespaceOf(l.Namespace)
+	if l.Protocol == "" {
+		l.Protocol = "tcp"
+	}
+	if l.Protocol != "tcp" && l.Protocol != "udp" {
+		return fmt.Errorf("unknown protocol %s", l.Protocol)
+	}
+	if l.ListenPort <= 0 || l.ListenPort > 65535 {
+		return fmt.Errorf("invalid listen port %d", l.ListenPort)
+	}
+	if l.DrainSeconds == 0 {
+		l.DrainSeconds = defaultDrainSeconds
+	}
+	if l.DrainSeconds < 0 {
+		return errors.New("drain period must not be negative")
+	}
+	return nil
+}
+
+// backend tracks the open connections to one endpoint so they can be
+// drained once the endpoint disappears from the registry.
+type backend struct {
+	conns        map[io.Closer]struct{}
+	drainingFrom time.Time
+}
+
+type l4Listener struct {
+	cfg Listener
+	ln  net.Listener
+	pc  net.PacketConn
+
+	mu       sync.Mutex
+	ready    []string
+	backends map[string]*backend
+	next     int
+	sessions map[string]*udpSession
+}
+
+type udpSession struct {
+	conn     *net.UDPConn
+	backend  string
+	lastSeen time.Time
+}
+
+// L4Proxy forwards raw TCP connections and UDP datagrams arriving on a port
+// per service to the service's current endpoints.
+type L4Proxy struct {
+	Host     string
+	Registry *discovery.Registry
+
+	mu        sync.Mutex
+	listeners map[string]*l4Listener
+}
+
+func NewL4Proxy(host string, registry *discovery.Registry) *L4Proxy {
+	return &L4Proxy{
+		Host:      host,
+		Registry:  registry,
+		listeners: make(map[string]*l4Listener),
+	}
+}
+
+func (p *L4Proxy) AddListener(cfg *Listener) error {
+	err := cfg.validate()
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.listeners[cfg.Name]; ok {
+		return fmt.Errorf("load balancer %s already exists", cfg.Name)
+	}
+
+	l := &l4Listener{
+		cfg:      *cfg,
+		backends: make(map[string]*backend),
+		sessions: make(map[string]*udpSession),
+	}
+	addr := net.JoinHostPort(p.Host, fmt.Sprintf("%d", cfg.ListenPort))
+	if cfg.Protocol == "udp" {
+		l.pc, err = net.ListenPacket("udp", addr)
+	} else {
+		l.ln, err = net.Listen("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to listen on %s/%s: %v", addr, cfg.Protocol, err)
+	}
+	p.listeners[cfg.Name] = l
+	l.refresh(p.Registry)
+
+	log.Printf("[l4] forwarding %s/%s to service %s", addr, cfg.Protocol, cfg.Service)
+	if l.pc != nil {
+		go l.serveUDP()
+	} else {
+		go l.serveTCP()
+	}
+	return nil
+}
+
+func (p *L4Proxy) RemoveListener(namespace, name string) error {
+	p.mu.Lock()
+	l, ok := p.listeners[name]
+	ok = ok && l.cfg.Namespace == task.NamespaceOf(namespace)
+	if ok {
+		delete(p.listeners, name)
+	}
+	p.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("load balancer %s not found", name)
+	}
+	l.close()
+	return nil
+}
+
+// Listeners returns the listeners of a namespace.
+func (p *L4Proxy) Listeners(namespace string) []Listener {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	listeners := []Listener{}
+	for _, l := range p.listeners {
+		if l.cfg.Namespace == task.NamespaceOf(namespace) {
+			listeners = append(listeners, l.cfg)
+		}
+	}
+	sort.Slice(listeners, func(i, j int) bool { return listeners[i].Name < listeners[j].Name })
+	return listeners
+}
+
+// Sync refreshes the endpoints of every listener from the registry and
+// closes connections to removed endpoints once their drain period is over.
+func (p *L4Proxy) Sync() {
+	p.mu.Lock()
+	var listeners []*l4Listener
+	for _, l := range p.listeners {
+		listeners = append(listeners, l)
+	}
+	p.mu.Unlock()
+
+	for _, l := range listeners {
+		l.refresh(p.Registry)
+	}
+}
+
+func (p *L4Proxy) Run() {
+	for {
+		p.Sync()
+		time.Sleep(5 * time.Second)
+	}
+}
+
+func (l *l4Listener) refresh(registry *discovery.Registry) {
+	var ready []string
+	seen := make(map[string]bool)
+	for _, e := range registry.LookupIn(l.cfg.Namespace, l.cfg.Service) {
+		if l.cfg.ContainerPort != "" && e.ContainerPort != l.cfg.ContainerPort {
+			continue
+		}
+		if l.cfg.ContainerPort == "" && !strings.HasSuffix(e.ContainerPort, "/"+l.cfg.Protocol) {
+			continue
+		}
+		addr := endpointAddress(e)
+		if !seen[addr] {
+			seen[addr] = true
+			ready = append(ready, addr)
+		}
+	}
+
+	now := time.Now()
+	drain := time.Duration(l.cfg.DrainSeconds) * time.Second
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ready = ready
+	for addr, b := range l.backends {
+		if seen[addr] {
+			b.drainingFrom = time.Time{}
+			continue
+		}
+		if b.drainingFrom.IsZero() {
+			log.Printf("[l4] endpoint %s removed from %s, draining %d connection(s)", addr, l.cfg.Name, len(b.conns))
+			b.drainingFrom = now
+		}
+		if len(b.conns) == 0 {
+			delete(l.backends, addr)
+			continue
+		}
+		if now.Sub(b.drainingFrom) >= drain {
+			log.Printf("[l4] drain period of %s over, closing %d connection(s) to %s", l.cfg.Name, len(b.conns), addr)
+			for c := range b.conns {
+				c.Close()
+			}
+		}
+	}
+	for key, s := range l.sessions {
+		if now.Sub(s.lastSeen) > udpSessionTimeout {
+			s.conn.Close()
+			delete(l.sessions, key)
+		}
+	}
+}
+
+func (l *l4Listener) pick() (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.ready) == 0 {
+		return "", fmt.Errorf("no endpoints for service %s", l.cfg.Service)
+	}
+	addr := l.ready[l.next%len(l.ready)]
+	l.next++
+	return addr, nil
+}
+
+func (l *l4Listener) track(addr string, c io.Closer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.backends[addr]
+	if !ok {
+		b = &backend{conns: make(map[io.Closer]struct{})}
+		l.backends[addr] = b
+	}
+	b.conns[c] = struct{}{}
+}
+
+func (l *l4Listener) untrack(addr string, c io.Closer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b, ok := l.backends[addr]; ok {
+		delete(b.conns, c)
+	}
+}
+
+func (l *l4Listener) close() {
+	if l.ln != nil {
+		l.ln.Close()
+	}
+	if l.pc != nil {
+		l.pc.Close()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, b := range l.backends {
+		for c := range b.conns {
+			c.Close()
+		}
+	}
+	for _, s := range l.sessions {
+		s.conn.Close()
+	}
+}
+
+func (l *l4Listener) serveTCP() {
+	for {
+		conn, err := l.ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("[l4] error accepting connection on %s: %v", l.cfg.Name, err)
+			continue
+		}
+		go l.forwardTCP(conn)
+	}
+}
+
+func (l *l4Listener) forwardTCP(client net.Conn) {
+	defer client.Close()
+
+	var upstream net.Conn
+	var addr string
+	l.mu.Lock()
+	attempts := len(l.ready)
+	l.mu.Unlock()
+	for i := 0; i < attempts; i++ {
+		var err error
+		addr, err = l.pick()
+		if err != nil {
+			break
+		}
+		upstream, err = net.DialTimeout("tcp", addr, 5*time.Second)
+		if err == nil {
+			break
+		}
+		log.Printf("[l4] error connecting to %s for %s: %v", addr, l.cfg.Name, err)
+	}
+	if upstream == nil {
+		log.Printf("[l4] no reachable endpoint for %s, dropping connection from %v", l.cfg.Name, client.RemoteAddr())
+		return
+	}
+	defer upstream.Close()
+
+	l.track(addr, client)
+	defer l.untrack(addr, client)
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(upstream, client)
+		if c, ok := upstream.(*net.TCPConn); ok {
+			c.CloseWrite()
+		}
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(client, upstream)
+		if c, ok := client.(*net.TCPConn); ok {
+			c.CloseWrite()
+		}
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+}
+
+func (l *l4Listener) serveUDP() {
+	buf := make([]byte, 65535)
+	for {
+		n, clientAddr, err := l.pc.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("[l4] error reading datagram on %s: %v", l.cfg.Name, err)
+			continue
+		}
+
+		s, err := l.session(clientAddr)
+		if err != nil {
+			log.Printf("[l4] %v", err)
+			continue
+		}
+		_, err = s.conn.Write(buf[:n])
+		if err != nil {
+			log.Printf("[l4] error forwarding datagram to %s: %v", s.backend, err)
+		}
+	}
+}
+
+// session returns the upstream connection used for datagrams of a client,
+// creating one and starting to relay replies if needed.
+func (l *l4Listener) session(clientAddr net.Addr) (*udpSession, error) {
+	key := clientAddr.String()
+	l.mu.Lock()
+	s, ok := l.sessions[key]
+	if ok {
+		s.lastSeen = time.Now()
+		l.mu.Unlock()
+		return s, nil
+	}
+	l.mu.Unlock()
+
+	addr, err := l.pick()
+	if err != nil {
+		return nil, err
+	}
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		return nil, err
+	}
+
+	s = &udpSession{conn: conn, backend: addr, lastSeen: time.Now()}
+	l.mu.Lock()
+	l.sessions[key] = s
+	l.mu.Unlock()
+	l.track(addr, conn)
+
+	go func() {
+		defer l.untrack(addr, conn)
+		buf := make([]byte, 65535)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				l.mu.Lock()
+				if l.sessions[key] == s {
+					delete(l.sessions, key)
+				}
+				l.mu.Unlock()
+				return
+			}
+			l.pc.WriteTo(buf[:n], clientAddr)
+		}
+	}()
+	return s, nil
+}
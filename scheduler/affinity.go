@@ -0,0 +1,93 @@
+package scheduler
+
+import (
+	"cube/node"
+	"cube/task"
+)
+
+// placementAllows reports whether the node selector and required node
+// affinity of t allow it to run on n.
+func placementAllows(t task.Task, n *node.Node) bool {
+	for k, v := range t.NodeSelector {
+		if lv, ok := n.Labels[k]; !ok || lv != v {
+			return false
+		}
+	}
+	if t.Affinity != nil && t.Affinity.Node != nil {
+		return task.MatchesAll(t.Affinity.Node.Required, n.Labels)
+	}
+	return true
+}
+
+// runsMatching reports whether n runs a task other than t matching every
+// requirement.
+func runsMatching(t task.Task, n *node.Node, reqs []task.LabelRequirement) bool {
+	for _, ref := range n.Tasks {
+		if ref.ID != t.ID.String() && task.MatchesAll(reqs, ref.Labels) {
+			return true
+		}
+	}
+	return false
+}
+
+// taskAffinityAllows checks the required inter-task affinity and
+// anti-affinity of t against the tasks running on n. The first task of a
+// group that is attracted to its own labels would never find a node, so
+// required affinity is waived while no node runs a matching task and t
+// matches the requirements itself.
+func taskAffinityAllows(t task.Task, n *node.Node, nodes []*node.Node) bool {
+	if t.Affinity == nil {
+		return true
+	}
+	if a := t.Affinity.AntiTask; a != nil && len(a.Required) > 0 && runsMatching(t, n, a.Required) {
+		return false
+	}
+	if a := t.Affinity.Task; a != nil && len(a.Required) > 0 && !runsMatching(t, n, a.Required) {
+		if !task.MatchesAll(a.Required, t.Labels) {
+			return false
+		}
+		for _, other := range nodes {
+			if runsMatching(t, other, a.Required) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// preference returns the share, between 0 and 1, of the preferred node and
+// inter-task affinity weight of t that n satisfies.
+func preference(t task.Task, n *node.Node) float64 {
+	if t.Affinity == nil {
+		return 0
+	}
+	var total, matched int
+	if a := t.Affinity.Node; a != nil {
+		for _, p := range a.Preferred {
+			total += p.Weight
+			if task.MatchesAll(p.Requirements, n.Labels) {
+				matched += p.Weight
+			}
+		}
+	}
+	if a := t.Affinity.Task; a != nil {
+		for _, p := range a.Preferred {
+			total += p.Weight
+			if runsMatching(t, n, p.Requirements) {
+				matched += p.Weight
+			}
+		}
+	}
+	if a := t.Affinity.AntiTask; a != nil {
+		for _, p := range a.Preferred {
+			total += p.Weight
+			if !runsMatching(t, n, p.Requirements) {
+				matched += p.Weight
+			}
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(matched) / float64(total)
+}
@@ -0,0 +1,79 @@
+package scheduler
+
+import (
+	"cube/node"
+	"cube/task"
+	"math"
+)
+
+// MostAllocated packs tasks onto the nodes with the highest share of their
+// CPU and memory already reserved, consolidating workloads so that whole
+// nodes are freed.
+type MostAllocated struct {
+	Name string
+}
+
+// LeastAllocated spreads tasks onto the nodes with the most unreserved CPU
+// and memory, favouring nodes where both would stay at a similar share so
+// that neither runs out while the other is idle.
+type LeastAllocated struct {
+	Name string
+}
+
+// utilization returns the share of the CPU and memory of n that would be
+// reserved once t is placed there. A resource the node has not reported
+// capacity for counts as unused.
+func utilization(t task.Task, n *node.Node) (cpu float64, memory float64) {
+	if n.Cpu > 0 {
+		cpu = math.Min((n.CpuAllocated+t.Cpu)/n.Cpu, 1)
+	}
+	if n.Memory > 0 {
+		memory = math.Min(float64(n.MemoryAllocated+memoryKb(t))/float64(n.Memory), 1)
+	}
+	return cpu, memory
+}
+
+// pickLowest returns the candidate with the lowest score.
+func pickLowest(scores map[string]float64, candidates []*node.Node) *node.Node {
+	var bestNode *node.Node
+	for _, n := range candidates {
+		if bestNode == nil || scores[n.Name] < scores[bestNode.Name] {
+			bestNode = n
+		}
+	}
+	return bestNode
+}
+
+func (s *MostAllocated) SelectCandidateNodes(t task.Task, nodes []*node.Node) []*node.Node {
+	return feasible(t, nodes)
+}
+
+func (s *MostAllocated) Score(t task.Task, nodes []*node.Node) map[string]float64 {
+	nodeScores := make(map[string]float64)
+	for _, n := range nodes {
+		cpu, memory := utilization(t, n)
+		nodeScores[n.Name] = 1 - (cpu+memory)/2 + spreadPenalty(t, n, nodes) + taintPenalty(t, n) - preference(t, n)
+	}
+	return nodeScores
+}
+
+func (s *MostAllocated) Pick(scores map[string]float64, candidates []*node.Node) *node.Node {
+	return pickLowest(scores, candidates)
+}
+
+func (s *LeastAllocated) SelectCandidateNodes(t task.Task, nodes []*node.Node) []*node.Node {
+	return feasible(t, nodes)
+}
+
+func (s *LeastAllocated) Score(t task.Task, nodes []*node.Node) map[string]float64 {
+	nodeScores := make(map[string]float64)
+	for _, n := range nodes {
+		cpu, memory := utilization(t, n)
+		nodeScores[n.Name] = (cpu+memory)/2 + math.Abs(cpu-memory)/2 + spreadPenalty(t, n, nodes) + taintPenalty(t, n) - preference(t, n)
+	}
+	return nodeScores
+}
+
+func (s *LeastAllocated) Pick(scores map[string]float64, candidates []*node.Node) *node.Node {
+	return pickLowest(scores, candidates)
+}
@@ -0,0 +1,70 @@
+package scheduler
+
+import (
+	"cube/node"
+	"cube/task"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrNoCandidates = errors.New("no available candidates match resource request")
+
+// Schedule selects a node for t with s and explains the decision. Nodes s
+// rejects are listed with the reason the first failing filter gives; the
+// scores of a profile are broken down by plugin.
+func Schedule(s Scheduler, t task.Task, nodes []*node.Node) (*node.Node, task.SchedulingAttempt) {
+	attempt := task.SchedulingAttempt{
+		Time:     time.Now().UTC(),
+		Filtered: make(map[string]string),
+		Scores:   make(map[string]map[string]float64),
+	}
+
+	candidates := s.SelectCandidateNodes(t, nodes)
+	accepted := make(map[string]bool)
+	for _, n := range candidates {
+		accepted[n.Name] = true
+	}
+	filters := &Profile{Filters: defaultFilters}
+	if p, ok := s.(*Profile); ok {
+		filters = p
+	}
+	for _, n := range nodes {
+		if accepted[n.Name] {
+			continue
+		}
+		err := filters.filter(t, n, nodes)
+		if err == nil {
+			err = errors.New("rejected by the scheduler")
+		}
+		attempt.Filtered[n.Name] = err.Error()
+	}
+	if len(candidates) == 0 {
+		attempt.Error = fmt.Sprintf("%v: %d nodes filtered out", ErrNoCandidates, len(nodes))
+		return nil, attempt
+	}
+
+	var scores map[string]float64
+	if p, ok := s.(*Profile); ok {
+		scores = make(map[string]float64)
+		for name, breakdown := range p.scores(t, candidates) {
+			attempt.Scores[name] = breakdown
+			for _, v := range breakdown {
+				scores[name] += v
+			}
+		}
+	} else {
+		scores = s.Score(t, candidates)
+		for name, v := range scores {
+			attempt.Scores[name] = map[string]float64{"score": v}
+		}
+	}
+
+	selected := s.Pick(scores, candidates)
+	if selected == nil {
+		attempt.Error = "no candidate could be scored"
+		return nil, attempt
+	}
+	attempt.Node = selected.Name
+	return selected, attempt
+}
@@ -0,0 +1,210 @@
+package scheduler
+
+import (
+	"cube/node"
+	"cube/task"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+// FilterPlugin rejects the nodes a task cannot run on. Filter returns why
+// n was rejected, or nil if t may run there. nodes holds every node under
+// consideration for rules that look across nodes.
+type FilterPlugin interface {
+	Name() string
+	Filter(t task.Task, n *node.Node, nodes []*node.Node) error
+}
+
+// ScorePlugin rates how well n suits t. Like the schedulers, lower is
+// better. Scores are normalized across the candidates before weighting, so
+// plugins are free to use any scale. A node the plugin cannot rate is given
+// math.Inf(1).
+type ScorePlugin interface {
+	Name() string
+	Score(t task.Task, n *node.Node, nodes []*node.Node) float64
+}
+
+type WeightedScore struct {
+	Plugin ScorePlugin
+	Weight float64
+}
+
+// Profile is a Scheduler assembled from plugins: a node is a candidate if
+// every filter accepts it, and the candidate with the lowest weighted sum
+// of normalized scores is picked.
+type Profile struct {
+	Name    string
+	Filters []FilterPlugin
+	Scores  []WeightedScore
+}
+
+func (p *Profile) SelectCandidateNodes(t task.Task, nodes []*node.Node) []*node.Node {
+	var candidates []*node.Node
+	for _, n := range nodes {
+		if p.filter(t, n, nodes) == nil {
+			candidates = append(candidates, n)
+		}
+	}
+	return candidates
+}
+
+// filter returns the reason the first rejecting filter gives for n.
+func (p *Profile) filter(t task.Task, n *node.Node, nodes []*node.Node) error {
+	for _, f := range p.Filters {
+		err := f.Filter(t, n, nodes)
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.Name(), err)
+		}
+	}
+	return nil
+}
+
+func (p *Profile) Score(t task.Task, nodes []*node.Node) map[string]float64 {
+	nodeScores := make(map[string]float64)
+	for name, breakdown := range p.scores(t, nodes) {
+		for _, s := range breakdown {
+			nodeScores[name] += s
+		}
+	}
+	return nodeScores
+}
+
+// scores returns the weighted, normalized score of every plugin for every
+// node. Each plugin's raw scores are scaled to between 0 for the best and
+// 1 for the worst node; unscored nodes get 1 and do not stretch the scale
+// of the others.
+func (p *Profile) scores(t task.Task, nodes []*node.Node) map[string]map[string]float64 {
+	breakdown := make(map[string]map[string]float64)
+	for _, n := range nodes {
+		breakdown[n.Name] = make(map[string]float64)
+	}
+	for _, ws := range p.Scores {
+		raw := make(map[string]float64)
+		min, max := math.Inf(1), math.Inf(-1)
+		for _, n := range nodes {
+			s := ws.Plugin.Score(t, n, nodes)
+			raw[n.Name] = s
+			if s == unscored {
+				continue
+			}
+			min = math.Min(min, s)
+			max = math.Max(max, s)
+		}
+		for name, s := range raw {
+			var normalized float64
+			if s == unscored {
+				normalized = 1
+			} else if max > min {
+				normalized = (s - min) / (max - min)
+			}
+			breakdown[name][ws.Plugin.Name()] = ws.Weight * normalized
+		}
+	}
+	return breakdown
+}
+
+func (p *Profile) Pick(scores map[string]float64, candidates []*node.Node) *node.Node {
+	return pickLowest(scores, candidates)
+}
+
+// Registry holds the plugins profiles can be built from.
+type Registry struct {
+	mu      sync.RWMutex
+	filters map[string]FilterPlugin
+	scores  map[string]ScorePlugin
+}
+
+// NewRegistry returns a registry with the built-in plugins.
+func NewRegistry() *Registry {
+	r := &Registry{
+		filters: make(map[string]FilterPlugin),
+		scores:  make(map[string]ScorePlugin),
+	}
+	for _, f := range defaultFilters {
+		r.RegisterFilter(f)
+	}
+	for _, s := range builtinScores {
+		r.RegisterScore(s)
+	}
+	return r
+}
+
+// DefaultRegistry is used for the profiles in the manager configuration.
+// Register custom plugins with it before the manager starts.
+var DefaultRegistry = NewRegistry()
+
+func (r *Registry) RegisterFilter(f FilterPlugin) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.filters[f.Name()] = f
+}
+
+func (r *Registry) RegisterScore(s ScorePlugin) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.scores[s.Name()] = s
+}
+
+// Plugins returns the names of the registered filter and score plugins.
+func (r *Registry) Plugins() (filters []string, scores []string) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for name := range r.filters {
+		filters = append(filters, name)
+	}
+	for name := range r.scores {
+		scores = append(scores, name)
+	}
+	sort.Strings(filters)
+	sort.Strings(scores)
+	return filters, scores
+}
+
+// ScoreWeight names a score plugin and its weight in a profile.
+type ScoreWeight struct {
+	Plugin string
+	Weight float64
+}
+
+// Profile builds a profile from registered plugins. Without filters the
+// built-in filters are used, which every scheduler applies. The mandatory
+// unschedulable and taints filters always come first, listed or not.
+func (r *Registry) Profile(name string, filters []string, scores []ScoreWeight) (*Profile, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p := &Profile{Name: name}
+	if len(filters) == 0 {
+		p.Filters = defaultFilters
+	} else {
+		p.Filters = append(p.Filters, mandatoryFilters...)
+	}
+filters:
+	for _, f := range filters {
+		for _, m := range mandatoryFilters {
+			if f == m.Name() {
+				continue filters
+			}
+		}
+		plugin, ok := r.filters[f]
+		if !ok {
+			return nil, fmt.Errorf("profile %s: unknown filter plugin %q", name, f)
+		}
+		p.Filters = append(p.Filters, plugin)
+	}
+	if len(scores) == 0 {
+		return nil, fmt.Errorf("profile %s: no score plugins", name)
+	}
+	for _, s := range scores {
+		plugin, ok := r.scores[s.Plugin]
+		if !ok {
+			return nil, fmt.Errorf("profile %s: unknown score plugin %q", name, s.Plugin)
+		}
+		if s.Weight <= 0 {
+			return nil, fmt.Errorf("profile %s: score plugin %s needs a positive weight", name, s.Plugin)
+		}
+		p.Scores = append(p.Scores, WeightedScore{Plugin: plugin, Weight: s.Weight})
+	}
+	return p, nil
+}
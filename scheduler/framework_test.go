@@ -0,0 +1,105 @@
+package scheduler
+
+import (
+	"cube/node"
+	"cube/task"
+	"reflect"
+	"testing"
+)
+
+func TestRegistryProfileFilters(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			want: []string{"unschedulable", "resources", "taints", "nodeAffinity", "taskAffinity", "topologySpread"},
+		},
+		{
+			name:    "mandatory filters are prepended",
+			filters: []string{"resources"},
+			want:    []string{"unschedulable", "taints", "resources"},
+		},
+		{
+			name:    "mandatory filters are not repeated",
+			filters: []string{"taints", "resources", "unschedulable"},
+			want:    []string{"unschedulable", "taints", "resources"},
+		},
+		{
+			name:    "unknown filter",
+			filters: []string{"nope"},
+			wantErr: true,
+		},
+	}
+	r := NewRegistry()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := r.Profile("test", tt.filters, []ScoreWeight{{Plugin: "leastAllocated", Weight: 1}})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Profile() succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, f := range p.Filters {
+				got = append(got, f.Name())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filters = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProfileKeepsCordonedAndTaintedNodesOut(t *testing.T) {
+	r := NewRegistry()
+	p, err := r.Profile("test", []string{"resources"}, []ScoreWeight{{Plugin: "leastAllocated", Weight: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := []*node.Node{
+		{Name: "cordoned", Unschedulable: true},
+		{Name: "tainted", Taints: []node.Taint{{Key: "gpu", Effect: node.NoSchedule}}},
+		{Name: "free"},
+	}
+	got := p.SelectCandidateNodes(task.Task{}, nodes)
+	if len(got) != 1 || got[0].Name != "free" {
+		t.Errorf("candidates = %v, want only free", got)
+	}
+}
+
+func TestProfileScoresUnscored(t *testing.T) {
+	raw := map[string]float64{"a": 1, "b": 3, "c": unscored}
+	plugin := scorePlugin{"raw", func(t task.Task, n *node.Node, nodes []*node.Node) float64 {
+		return raw[n.Name]
+	}}
+	tests := []struct {
+		name  string
+		nodes []string
+		want  map[string]float64
+	}{
+		{"unscored node ranks last", []string{"a", "b", "c"}, map[string]float64{"a": 0, "b": 2, "c": 2}},
+		{"scored nodes only", []string{"a", "b"}, map[string]float64{"a": 0, "b": 2}},
+		{"all unscored", []string{"c"}, map[string]float64{"c": 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Profile{Scores: []WeightedScore{{Plugin: plugin, Weight: 2}}}
+			var nodes []*node.Node
+			for _, name := range tt.nodes {
+				nodes = append(nodes, &node.Node{Name: name})
+			}
+			got := p.Score(task.Task{}, nodes)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Score() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
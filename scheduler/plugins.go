@@ -0,0 +1,125 @@
+package scheduler
+
+import (
+	"cube/node"
+	"cube/task"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+)
+
+type filterPlugin struct {
+	name   string
+	filter func(t task.Task, n *node.Node, nodes []*node.Node) error
+}
+
+func (f filterPlugin) Name() string { return f.name }
+
+func (f filterPlugin) Filter(t task.Task, n *node.Node, nodes []*node.Node) error {
+	return f.filter(t, n, nodes)
+}
+
+type scorePlugin struct {
+	name  string
+	score func(t task.Task, n *node.Node, nodes []*node.Node) float64
+}
+
+func (s scorePlugin) Name() string { return s.name }
+
+func (s scorePlugin) Score(t task.Task, n *node.Node, nodes []*node.Node) float64 {
+	return s.score(t, n, nodes)
+}
+
+var unschedulableFilter = filterPlugin{"unschedulable", func(t task.Task, n *node.Node, nodes []*node.Node) error {
+	if n.Unschedulable {
+		return errors.New("node is cordoned")
+	}
+	return nil
+}}
+
+var taintsFilter = filterPlugin{"taints", func(t task.Task, n *node.Node, nodes []*node.Node) error {
+	if !toleratesTaints(t, n) {
+		return fmt.Errorf("node has taints %v the task does not tolerate", n.Taints)
+	}
+	return nil
+}}
+
+// mandatoryFilters keep cordoned and tainted nodes off limits. Every
+// profile applies them, whatever filters it lists.
+var mandatoryFilters = []FilterPlugin{unschedulableFilter, taintsFilter}
+
+// defaultFilters are applied by every built-in scheduler.
+var defaultFilters = []FilterPlugin{
+	unschedulableFilter,
+	filterPlugin{"resources", func(t task.Task, n *node.Node, nodes []*node.Node) error {
+		return checkFit(t, n)
+	}},
+	taintsFilter,
+	filterPlugin{"nodeAffinity", func(t task.Task, n *node.Node, nodes []*node.Node) error {
+		if !placementAllows(t, n) {
+			return errors.New("node selector or required node affinity does not match")
+		}
+		return nil
+	}},
+	filterPlugin{"taskAffinity", func(t task.Task, n *node.Node, nodes []*node.Node) error {
+		if !taskAffinityAllows(t, n, nodes) {
+			return errors.New("required task affinity or anti-affinity is not satisfied")
+		}
+		return nil
+	}},
+	filterPlugin{"topologySpread", func(t task.Task, n *node.Node, nodes []*node.Node) error {
+		if !spreadAllows(t, n, nodes) {
+			return errors.New("a hard topology spread constraint would be exceeded")
+		}
+		return nil
+	}},
+}
+
+// unscored is given by score plugins to nodes they cannot rate. Such nodes
+// rank last for the plugin and are left out when its scores are
+// normalized.
+var unscored = math.Inf(1)
+
+var builtinScores = []ScorePlugin{
+	scorePlugin{"leastAllocated", func(t task.Task, n *node.Node, nodes []*node.Node) float64 {
+		cpu, memory := utilization(t, n)
+		return (cpu + memory) / 2
+	}},
+	scorePlugin{"mostAllocated", func(t task.Task, n *node.Node, nodes []*node.Node) float64 {
+		cpu, memory := utilization(t, n)
+		return 1 - (cpu+memory)/2
+	}},
+	scorePlugin{"balancedAllocation", func(t task.Task, n *node.Node, nodes []*node.Node) float64 {
+		cpu, memory := utilization(t, n)
+		if cpu > memory {
+			return cpu - memory
+		}
+		return memory - cpu
+	}},
+	scorePlugin{"affinity", func(t task.Task, n *node.Node, nodes []*node.Node) float64 {
+		return 1 - preference(t, n)
+	}},
+	scorePlugin{"topologySpread", func(t task.Task, n *node.Node, nodes []*node.Node) float64 {
+		return spreadPenalty(t, n, nodes)
+	}},
+	scorePlugin{"taints", func(t task.Task, n *node.Node, nodes []*node.Node) float64 {
+		return taintPenalty(t, n)
+	}},
+	scorePlugin{"imageLocality", func(t task.Task, n *node.Node, nodes []*node.Node) float64 {
+		for _, ref := range n.Tasks {
+			if ref.Image == t.Image {
+				return 0
+			}
+		}
+		return 1
+	}},
+	scorePlugin{"epvm", func(t task.Task, n *node.Node, nodes []*node.Node) float64 {
+		cost, err := epvmCost(t, n)
+		if err != nil {
+			log.Printf("error calculating CPU usage for node %s: %v", n.Name, err)
+			return unscored
+		}
+		return cost
+	}},
+}
@@ -0,0 +1,77 @@
+package scheduler
+
+import (
+	"cube/node"
+	"cube/task"
+	"sort"
+)
+
+// Victims picks the tasks to preempt so that t fits on a node when s finds
+// no candidate for it. tasks holds the tasks on the nodes by ID. On every
+// node all tasks of lower priority than t are taken off; if t then passes
+// the filters of s, as many of them as possible are put back, the most
+// important first. The node whose most important victim has the lowest
+// priority wins, then the node with the fewest victims. It returns nil if
+// preempting cannot make room for t.
+func Victims(s Scheduler, t task.Task, nodes []*node.Node, tasks map[string]task.Task) (*node.Node, []task.Task) {
+	var best *node.Node
+	var bestVictims []task.Task
+	bestPriority := 0
+	for i, n := range nodes {
+		var lower []task.Task
+		for _, ref := range n.Tasks {
+			v, ok := tasks[ref.ID]
+			if ok && v.Priority() < t.Priority() {
+				lower = append(lower, v)
+			}
+		}
+		if len(lower) == 0 {
+			continue
+		}
+
+		c := *n
+		for j := range lower {
+			Release(&c, &lower[j])
+		}
+		if !fits(s, t, nodes, i, &c) {
+			continue
+		}
+
+		sort.SliceStable(lower, func(a, b int) bool {
+			return lower[a].Priority() > lower[b].Priority()
+		})
+		var victims []task.Task
+		for j := range lower {
+			trial := c
+			Reserve(&trial, &lower[j])
+			if fits(s, t, nodes, i, &trial) {
+				c = trial
+				continue
+			}
+			victims = append(victims, lower[j])
+		}
+		if len(victims) == 0 {
+			continue
+		}
+
+		// victims are sorted, the first is the most important
+		priority := victims[0].Priority()
+		if best == nil || priority < bestPriority || (priority == bestPriority && len(victims) < len(bestVictims)) {
+			best, bestVictims, bestPriority = n, victims, priority
+		}
+	}
+	return best, bestVictims
+}
+
+// fits reports whether s accepts t on c when c replaces the node at index
+// i, so that filters looking across nodes see the change.
+func fits(s Scheduler, t task.Task, nodes []*node.Node, i int, c *node.Node) bool {
+	trial := append([]*node.Node(nil), nodes...)
+	trial[i] = c
+	for _, n := range s.SelectCandidateNodes(t, trial) {
+		if n == c {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package scheduler
+
+import (
+	"cube/node"
+	"cube/task"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestVictims(t *testing.T) {
+	newTask := func(name, class string, cpu float64) task.Task {
+		return task.Task{ID: uuid.New(), Name: name, PriorityClass: class, Cpu: cpu}
+	}
+	tests := []struct {
+		name     string
+		incoming task.Task
+		nodes    map[string][]task.Task
+		wantNode string
+		want     []string
+	}{
+		{
+			name:     "lowest priority victim",
+			incoming: newTask("new", "high", 2),
+			nodes: map[string][]task.Task{
+				"n1": {newTask("n1-normal", "normal", 2)},
+				"n2": {newTask("n2-low", "best-effort", 2)},
+			},
+			wantNode: "n2",
+			want:     []string{"n2-low"},
+		},
+		{
+			name:     "fewest victims on a tie",
+			incoming: newTask("new", "high", 2),
+			nodes: map[string][]task.Task{
+				"n1": {newTask("n1-a", "normal", 1), newTask("n1-b", "normal", 1)},
+				"n2": {newTask("n2-a", "normal", 2)},
+			},
+			wantNode: "n2",
+			want:     []string{"n2-a"},
+		},
+		{
+			name:     "more important tasks are put back",
+			incoming: newTask("new", "critical", 1),
+			nodes: map[string][]task.Task{
+				"n1": {newTask("n1-low", "best-effort", 1), newTask("n1-high", "high", 1)},
+			},
+			wantNode: "n1",
+			want:     []string{"n1-low"},
+		},
+		{
+			name:     "equal priority is never preempted",
+			incoming: newTask("new", "normal", 2),
+			nodes: map[string][]task.Task{
+				"n1": {newTask("n1-normal", "normal", 2)},
+			},
+		},
+		{
+			name:     "no room even without victims",
+			incoming: newTask("new", "critical", 3),
+			nodes: map[string][]task.Task{
+				"n1": {newTask("n1-low", "best-effort", 1)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var names []string
+			for name := range tt.nodes {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			var nodes []*node.Node
+			tasks := make(map[string]task.Task)
+			for _, name := range names {
+				n := &node.Node{Name: name, Cpu: 2, Memory: 1 << 20, Disk: 1 << 30}
+				for _, v := range tt.nodes[name] {
+					v := v
+					Reserve(n, &v)
+					tasks[v.ID.String()] = v
+				}
+				nodes = append(nodes, n)
+			}
+
+			n, victims := Victims(&LeastAllocated{}, tt.incoming, nodes, tasks)
+			if tt.wantNode == "" {
+				if n != nil {
+					t.Errorf("Victims() picked node %s, want none", n.Name)
+				}
+				return
+			}
+			if n == nil {
+				t.Fatalf("Victims() picked no node, want %s", tt.wantNode)
+			}
+			var got []string
+			for _, v := range victims {
+				got = append(got, v.Name)
+			}
+			if n.Name != tt.wantNode || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Victims() = %s %v, want %s %v", n.Name, got, tt.wantNode, tt.want)
+			}
+		})
+	}
+}
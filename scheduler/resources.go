@@ -0,0 +1,82 @@
+package scheduler
+
+import (
+	"cube/node"
+	"cube/task"
+	"errors"
+	"fmt"
+)
+
+// checkFit reports why n lacks the unreserved CPU, memory or disk for the
+// requests of t, or which host port t binds is taken. A node that has not
+// reported the capacity of a resource t requests is rejected until it does.
+func checkFit(t task.Task, n *node.Node) error {
+	if t.Cpu > 0 && n.Cpu <= 0 {
+		return errors.New("unknown cpu capacity: node has not reported it")
+	}
+	if t.Cpu > 0 && n.CpuAllocated+t.Cpu > n.Cpu {
+		return fmt.Errorf("insufficient cpu: %g of %g reserved, %g requested", n.CpuAllocated, n.Cpu, t.Cpu)
+	}
+	if t.Memory > 0 && n.Memory <= 0 {
+		return errors.New("unknown memory capacity: node has not reported it")
+	}
+	if t.Memory > 0 && n.MemoryAllocated+memoryKb(t) > n.Memory {
+		return fmt.Errorf("insufficient memory: %d of %d KB reserved, %d requested", n.MemoryAllocated, n.Memory, memoryKb(t))
+	}
+	if t.Disk > 0 && n.Disk <= 0 {
+		return errors.New("unknown disk capacity: node has not reported it")
+	}
+	if t.Disk > 0 && !checkDisk(t, n.Disk-n.DiskAllocated) {
+		return fmt.Errorf("insufficient disk: %d of %d bytes reserved, %d requested", n.DiskAllocated, n.Disk, t.Disk)
+	}
+	for _, p := range t.BoundPorts() {
+		for _, used := range n.PortsAllocated {
+			if p == used {
+				return fmt.Errorf("host port %s is in use", p)
+			}
+		}
+	}
+	return nil
+}
+
+// memoryKb converts the memory request of t, in bytes, to the KB that node
+// capacity and allocation are kept in.
+func memoryKb(t task.Task) int64 {
+	return t.Memory / 1024
+}
+
+// Reserve accounts the requests of t against n.
+func Reserve(n *node.Node, t *task.Task) {
+	n.Tasks = append(n.Tasks, node.TaskRef{ID: t.ID.String(), Name: t.Name, Service: t.Service, Image: t.Image, Labels: t.Labels})
+	n.TaskCount = len(n.Tasks)
+	n.CpuAllocated += t.Cpu
+	n.MemoryAllocated += memoryKb(*t)
+	n.DiskAllocated += t.Disk
+	n.PortsAllocated = append(n.PortsAllocated, t.BoundPorts()...)
+}
+
+// Release undoes Reserve. It copies the slices it changes so that n may be
+// a shallow copy of another node.
+func Release(n *node.Node, t *task.Task) {
+	var tasks []node.TaskRef
+	for _, ref := range n.Tasks {
+		if ref.ID != t.ID.String() {
+			tasks = append(tasks, ref)
+		}
+	}
+	n.Tasks = tasks
+	n.TaskCount = len(n.Tasks)
+	n.CpuAllocated -= t.Cpu
+	n.MemoryAllocated -= memoryKb(*t)
+	n.DiskAllocated -= t.Disk
+	ports := append([]string(nil), n.PortsAllocated...)
+	for _, p := range t.BoundPorts() {
+		for i := range ports {
+			if ports[i] == p {
+				ports = append(ports[:i], ports[i+1:]...)
+				break
+			}
+		}
+	}
+	n.PortsAllocated = ports
+}
@@ -0,0 +1,152 @@
+package scheduler
+
+import (
+	"cube/node"
+	"cube/task"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestCheckFit(t *testing.T) {
+	tests := []struct {
+		name string
+		task task.Task
+		node node.Node
+		want string
+	}{
+		{
+			name: "fits",
+			task: task.Task{Cpu: 1, Memory: 512 * 1024, Disk: 100},
+			node: node.Node{Cpu: 2, Memory: 1024, Disk: 1000},
+		},
+		{
+			name: "no requests on a node without capacity",
+			task: task.Task{},
+			node: node.Node{},
+		},
+		{
+			name: "exactly full",
+			task: task.Task{Cpu: 1, Memory: 512 * 1024},
+			node: node.Node{Cpu: 2, CpuAllocated: 1, Memory: 1024, MemoryAllocated: 512},
+		},
+		{
+			name: "unknown cpu capacity",
+			task: task.Task{Cpu: 0.5},
+			node: node.Node{Memory: 1024, Disk: 1000},
+			want: "unknown cpu capacity",
+		},
+		{
+			name: "unknown memory capacity",
+			task: task.Task{Memory: 1024},
+			node: node.Node{Cpu: 2},
+			want: "unknown memory capacity",
+		},
+		{
+			name: "unknown disk capacity",
+			task: task.Task{Disk: 1},
+			node: node.Node{Cpu: 2, Memory: 1024},
+			want: "unknown disk capacity",
+		},
+		{
+			name: "insufficient cpu",
+			task: task.Task{Cpu: 1.5},
+			node: node.Node{Cpu: 2, CpuAllocated: 1},
+			want: "insufficient cpu",
+		},
+		{
+			name: "insufficient memory",
+			task: task.Task{Memory: 1024 * 1024},
+			node: node.Node{Memory: 1024, MemoryAllocated: 1},
+			want: "insufficient memory",
+		},
+		{
+			name: "insufficient disk",
+			task: task.Task{Disk: 600},
+			node: node.Node{Disk: 1000, DiskAllocated: 500},
+			want: "insufficient disk",
+		},
+		{
+			name: "host port in use",
+			task: task.Task{PortBindings: map[string]string{"80/tcp": "8080"}},
+			node: node.Node{PortsAllocated: []string{"8080/tcp"}},
+			want: "host port 8080/tcp is in use",
+		},
+		{
+			name: "same port of another protocol",
+			task: task.Task{PortBindings: map[string]string{"53/udp": "8053"}},
+			node: node.Node{PortsAllocated: []string{"8053/tcp"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkFit(tt.task, &tt.node)
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("checkFit() = %v, want nil", err)
+			case tt.want != "" && err == nil:
+				t.Errorf("checkFit() = nil, want %q", tt.want)
+			case tt.want != "" && !strings.Contains(err.Error(), tt.want):
+				t.Errorf("checkFit() = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReserveRelease(t *testing.T) {
+	tests := []struct {
+		name  string
+		tasks []task.Task
+	}{
+		{
+			name:  "one task",
+			tasks: []task.Task{{ID: uuid.New(), Cpu: 1, Memory: 2048, Disk: 10}},
+		},
+		{
+			name: "tasks with ports",
+			tasks: []task.Task{
+				{ID: uuid.New(), Cpu: 0.5, Memory: 1024, PortBindings: map[string]string{"80/tcp": "8080"}},
+				{ID: uuid.New(), Cpu: 0.25, Disk: 5, PortBindings: map[string]string{"53/udp": "8053"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := node.Node{Cpu: 4, Memory: 1 << 20, Disk: 1 << 30}
+			var cpu float64
+			var memory, disk int64
+			var ports []string
+			for i := range tt.tasks {
+				Reserve(&n, &tt.tasks[i])
+				cpu += tt.tasks[i].Cpu
+				memory += tt.tasks[i].Memory / 1024
+				disk += tt.tasks[i].Disk
+				ports = append(ports, tt.tasks[i].BoundPorts()...)
+			}
+			if n.CpuAllocated != cpu || n.MemoryAllocated != memory || n.DiskAllocated != disk {
+				t.Errorf("reserved cpu %g, memory %d, disk %d, want %g, %d, %d", n.CpuAllocated, n.MemoryAllocated, n.DiskAllocated, cpu, memory, disk)
+			}
+			if n.TaskCount != len(tt.tasks) || len(n.PortsAllocated) != len(ports) {
+				t.Errorf("reserved %d tasks and ports %v, want %d and %v", n.TaskCount, n.PortsAllocated, len(tt.tasks), ports)
+			}
+
+			// releasing a shallow copy leaves the original untouched
+			c := n
+			for i := range tt.tasks {
+				Release(&c, &tt.tasks[i])
+			}
+			if c.CpuAllocated != 0 || c.MemoryAllocated != 0 || c.DiskAllocated != 0 || c.TaskCount != 0 || len(c.PortsAllocated) != 0 {
+				t.Errorf("after Release got %+v, want nothing allocated", c)
+			}
+			if n.TaskCount != len(tt.tasks) || len(n.PortsAllocated) != len(ports) {
+				t.Errorf("Release changed the original node: %+v", n)
+			}
+			for i := range tt.tasks {
+				if checkFit(tt.tasks[i], &c) != nil {
+					t.Errorf("task %d does not fit after Release", i)
+				}
+			}
+		})
+	}
+}
@@ -28,8 +28,14 @@ type Epvm struct {
 	Name string
 }
 
+// feasible drops the nodes that any of the built-in filters rejects.
+func feasible(t task.Task, nodes []*node.Node) []*node.Node {
+	p := Profile{Filters: defaultFilters}
+	return p.SelectCandidateNodes(t, nodes)
+}
+
 func (r *RoundRobin) SelectCandidateNodes(t task.Task, nodes []*node.Node) []*node.Node {
-	return nodes
+	return feasible(t, nodes)
 }
 
 func (r *RoundRobin) Score(t task.Task, nodes []*node.Node) map[string]float64 {
@@ -48,6 +54,7 @@ func (r *RoundRobin) Score(t task.Task, nodes []*node.Node) map[string]float64 {
 		} else {
 			nodeScores[node.Name] = 1.0
 		}
+		nodeScores[node.Name] += spreadPenalty(t, node, nodes) + taintPenalty(t, node) - preference(t, node)
 	}
 	return nodeScores
 }
@@ -70,13 +77,7 @@ func (r *RoundRobin) Pick(scores map[string]float64, candidates []*node.Node) *n
 }
 
 func (e *Epvm) SelectCandidateNodes(t task.Task, nodes []*node.Node) []*node.Node {
-	var candidates []*node.Node
-	for node := range nodes {
-		if checkDisk(t, nodes[node].Disk-nodes[node].DiskAllocated) {
-			candidates = append(candidates, nodes[node])
-		}
-	}
-	return candidates
+	return feasible(t, nodes)
 }
 func checkDisk(t task.Task, diskAvailable int64) bool {
 	return t.Disk <= diskAvailable
@@ -117,26 +118,34 @@ func calculateCpuUsage(node *node.Node) (*float64, error) {
 
 func (e *Epvm) Score(t task.Task, nodes []*node.Node) map[string]float64 {
 	nodeScores := make(map[string]float64)
-	maxJobs := 4.0
-
 	for _, node := range nodes {
-		cpuUsage, err := calculateCpuUsage(node)
+		cost, err := epvmCost(t, node)
 		if err != nil {
 			log.Printf("error calculating CPU usage for node %s, skipping: %v", node.Name, err)
 			continue
 		}
-		cpuLoad := calculateLoad(*cpuUsage, math.Pow(2, 0.8))
-
-		memoryAllocated := float64(node.Stats.MemUsedKb()) + float64(node.MemoryAllocated)
-		memoryPercentAllocated := memoryAllocated / float64(node.Memory)
+		nodeScores[node.Name] = cost + spreadPenalty(t, node, nodes) + taintPenalty(t, node) - preference(t, node)
+	}
+	return nodeScores
+}
 
-		newMemPercent := (calculateLoad(memoryAllocated+float64(t.Memory/1000), float64(node.Memory)))
-		memCost := math.Pow(LIEB, newMemPercent) + math.Pow(LIEB, (float64(node.TaskCount+1))/maxJobs) - math.Pow(LIEB, memoryPercentAllocated) - math.Pow(LIEB, float64(node.TaskCount)/float64(maxJobs))
-		cpuCost := math.Pow(LIEB, cpuLoad) + math.Pow(LIEB, (float64(node.TaskCount+1))/maxJobs) - math.Pow(LIEB, cpuLoad) - math.Pow(LIEB, float64(node.TaskCount)/float64(maxJobs))
+// epvmCost is the marginal memory and CPU cost of placing t on node.
+func epvmCost(t task.Task, node *node.Node) (float64, error) {
+	maxJobs := 4.0
 
-		nodeScores[node.Name] = memCost + cpuCost
+	cpuUsage, err := calculateCpuUsage(node)
+	if err != nil {
+		return 0, err
 	}
-	return nodeScores
+	cpuLoad := calculateLoad(*cpuUsage, math.Pow(2, 0.8))
+
+	memoryAllocated := float64(node.Stats.MemUsedKb()) + float64(node.MemoryAllocated)
+	memoryPercentAllocated := memoryAllocated / float64(node.Memory)
+
+	newMemPercent := (calculateLoad(memoryAllocated+float64(memoryKb(t)), float64(node.Memory)))
+	memCost := math.Pow(LIEB, newMemPercent) + math.Pow(LIEB, (float64(node.TaskCount+1))/maxJobs) - math.Pow(LIEB, memoryPercentAllocated) - math.Pow(LIEB, float64(node.TaskCount)/float64(maxJobs))
+	cpuCost := math.Pow(LIEB, cpuLoad) + math.Pow(LIEB, (float64(node.TaskCount+1))/maxJobs) - math.Pow(LIEB, cpuLoad) - math.Pow(LIEB, float64(node.TaskCount)/float64(maxJobs))
+	return memCost + cpuCost, nil
 }
 
 func (e *Epvm) Pick(scores map[string]float64, candidates []*node.Node) *node.Node {
@@ -0,0 +1,85 @@
+package scheduler
+
+import (
+	"cube/node"
+	"cube/task"
+)
+
+// spreadCounts returns, per value of the topology key, the number of tasks
+// the constraint counts. Nodes without the key form no domain.
+func spreadCounts(t task.Task, c task.SpreadConstraint, nodes []*node.Node) map[string]int {
+	counts := make(map[string]int)
+	for _, n := range nodes {
+		domain, ok := n.Labels[c.TopologyKey]
+		if !ok {
+			continue
+		}
+		counts[domain] += 0
+		for _, ref := range n.Tasks {
+			if ref.ID == t.ID.String() {
+				continue
+			}
+			if len(c.Selector) > 0 {
+				if task.MatchesAll(c.Selector, ref.Labels) {
+					counts[domain]++
+				}
+			} else if t.Service != "" && ref.Service == t.Service {
+				counts[domain]++
+			}
+		}
+	}
+	return counts
+}
+
+// skew returns how far placing t on n would put the domain of n above the
+// least loaded domain, and whether n belongs to a domain at all.
+func skew(t task.Task, c task.SpreadConstraint, n *node.Node, nodes []*node.Node) (int, bool) {
+	domain, ok := n.Labels[c.TopologyKey]
+	if !ok {
+		return 0, false
+	}
+	counts := spreadCounts(t, c, nodes)
+	min := counts[domain]
+	for _, count := range counts {
+		if count < min {
+			min = count
+		}
+	}
+	return counts[domain] + 1 - min, true
+}
+
+// spreadAllows checks the hard spread constraints of t. Nodes missing a
+// topology key cannot satisfy a hard constraint on it.
+func spreadAllows(t task.Task, n *node.Node, nodes []*node.Node) bool {
+	for _, c := range t.TopologySpread {
+		if !c.Hard() {
+			continue
+		}
+		s, ok := skew(t, c, n, nodes)
+		if !ok || s > c.MaxSkew {
+			return false
+		}
+	}
+	return true
+}
+
+// spreadPenalty scores the soft spread constraints of t: every constraint
+// adds the amount by which placing t on n would exceed its max skew, or 1
+// when n has no topology domain.
+func spreadPenalty(t task.Task, n *node.Node, nodes []*node.Node) float64 {
+	var penalty float64
+	for _, c := range t.TopologySpread {
+		if c.Hard() {
+			continue
+		}
+		s, ok := skew(t, c, n, nodes)
+		if !ok {
+			penalty++
+			continue
+		}
+		if s > c.MaxSkew {
+			penalty += float64(s - c.MaxSkew)
+		}
+	}
+	return penalty
+}
@@ -0,0 +1,29 @@
+package scheduler
+
+import (
+	"cube/node"
+	"cube/task"
+)
+
+// toleratesTaints reports whether t tolerates every NoSchedule and
+// NoExecute taint of n.
+func toleratesTaints(t task.Task, n *node.Node) bool {
+	for _, taint := range n.Taints {
+		if taint.Effect != node.PreferNoSchedule && !t.Tolerates(taint.Key, taint.Value, taint.Effect) {
+			return false
+		}
+	}
+	return true
+}
+
+// taintPenalty counts the PreferNoSchedule taints of n that t does not
+// tolerate.
+func taintPenalty(t task.Task, n *node.Node) float64 {
+	var penalty float64
+	for _, taint := range n.Taints {
+		if taint.Effect == node.PreferNoSchedule && !t.Tolerates(taint.Key, taint.Value, taint.Effect) {
+			penalty++
+		}
+	}
+	return penalty
+}
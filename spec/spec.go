@@ -0,0 +1,177 @@
+package spec
+
+import (
+	"bytes"
+	"cube/task"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/docker/go-connections/nat"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	KindTask    = "Task"
+	KindService = "Service"
+)
+
+type ResourceSpec struct {
+	Image          string                  `yaml:"image" json:"image"`
+	Replicas       *int                    `yaml:"replicas,omitempty" json:"replicas,omitempty"`
+	Cpu            string                  `yaml:"cpu,omitempty" json:"cpu,omitempty"`
+	Memory         string                  `yaml:"memory,omitempty" json:"memory,omitempty"`
+	Disk           string                  `yaml:"disk,omitempty" json:"disk,omitempty"`
+	Ports          []string                `yaml:"ports,omitempty" json:"ports,omitempty"`
+	HealthCheck    string                  `yaml:"healthCheck,omitempty" json:"healthCheck,omitempty"`
+	RestartPolicy  string                  `yaml:"restartPolicy,omitempty" json:"restartPolicy,omitempty"`
+	Labels         map[string]string       `yaml:"labels,omitempty" json:"labels,omitempty"`
+	NodeSelector   map[string]string       `yaml:"nodeSelector,omitempty" json:"nodeSelector,omitempty"`
+	Affinity       *task.Affinity          `yaml:"affinity,omitempty" json:"affinity,omitempty"`
+	TopologySpread []task.SpreadConstraint `yaml:"topologySpread,omitempty" json:"topologySpread,omitempty"`
+	Tolerations    []task.Toleration       `yaml:"tolerations,omitempty" json:"tolerations,omitempty"`
+	Scheduler      string                  `yaml:"scheduler,omitempty" json:"scheduler,omitempty"`
+	PriorityClass  string                  `yaml:"priorityClass,omitempty" json:"priorityClass,omitempty"`
+}
+
+// Resource is a named, human-readable description of a task or service.
+// Documents may be written in YAML or JSON.
+type Resource struct {
+	Kind string       `yaml:"kind" json:"kind"`
+	Name string       `yaml:"name" json:"name"`
+	Spec ResourceSpec `yaml:"spec" json:"spec"`
+}
+
+// Parse reads every document of a YAML or JSON stream.
+func Parse(data []byte) ([]Resource, error) {
+	var resources []Resource
+	d := yaml.NewDecoder(bytes.NewReader(data))
+	d.KnownFields(true)
+	for {
+		var r Resource
+		err := d.Decode(&r)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		err = r.Validate()
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, r)
+	}
+	if len(resources) == 0 {
+		return nil, errors.New("no resources in spec")
+	}
+	return resources, nil
+}
+
+func (r *Resource) Validate() error {
+	switch strings.ToLower(r.Kind) {
+	case "task":
+		r.Kind = KindTask
+		if r.Spec.Replicas != nil {
+			return fmt.Errorf("task %s cannot have replicas, use a service", r.Name)
+		}
+	case "service":
+		r.Kind = KindService
+		if r.Spec.Replicas != nil && *r.Spec.Replicas < 0 {
+			return fmt.Errorf("service %s has negative replicas", r.Name)
+		}
+	default:
+		return fmt.Errorf("unknown kind %q", r.Kind)
+	}
+	if r.Name == "" {
+		return fmt.Errorf("%s without a name", r.Kind)
+	}
+	if r.Spec.Image == "" {
+		return fmt.Errorf("%s %s has no image", r.Kind, r.Name)
+	}
+	t, err := r.Task()
+	if err != nil {
+		return err
+	}
+	err = t.ValidatePlacement()
+	if err != nil {
+		return fmt.Errorf("%s %s: %v", r.Kind, r.Name, err)
+	}
+	return nil
+}
+
+func (r *Resource) ReplicaCount() int {
+	if r.Spec.Replicas == nil {
+		return 1
+	}
+	return *r.Spec.Replicas
+}
+
+// Task returns the task template described by the resource with all units
+// converted: CPU in cores, memory and disk in bytes.
+func (r *Resource) Task() (task.Task, error) {
+	cpu, err := ParseCpu(r.Spec.Cpu)
+	if err != nil {
+		return task.Task{}, err
+	}
+	memory, err := ParseBytes(r.Spec.Memory)
+	if err != nil {
+		return task.Task{}, err
+	}
+	disk, err := ParseBytes(r.Spec.Disk)
+	if err != nil {
+		return task.Task{}, err
+	}
+
+	var ports nat.PortSet
+	var bindings map[string]string
+	if len(r.Spec.Ports) > 0 {
+		ports = nat.PortSet{}
+		for _, p := range r.Spec.Ports {
+			// host:container/proto binds the container port to a fixed
+			// host port, otherwise a random one is published
+			hostPort, containerPort, bound := strings.Cut(p, ":")
+			if !bound {
+				containerPort = p
+			}
+			proto, port := nat.SplitProtoPort(containerPort)
+			if port == "" {
+				return task.Task{}, fmt.Errorf("invalid port %s", p)
+			}
+			np, err := nat.NewPort(proto, port)
+			if err != nil {
+				return task.Task{}, err
+			}
+			ports[np] = struct{}{}
+			if bound {
+				if _, err := nat.ParsePort(hostPort); err != nil || hostPort == "" {
+					return task.Task{}, fmt.Errorf("invalid host port in %s", p)
+				}
+				if bindings == nil {
+					bindings = make(map[string]string)
+				}
+				bindings[string(np)] = hostPort
+			}
+		}
+	}
+
+	return task.Task{
+		Name:           r.Name,
+		Image:          r.Spec.Image,
+		Cpu:            cpu,
+		Memory:         memory,
+		Disk:           disk,
+		ExposedPorts:   ports,
+		PortBindings:   bindings,
+		HealthCheck:    r.Spec.HealthCheck,
+		RestartPolicy:  r.Spec.RestartPolicy,
+		Labels:         r.Spec.Labels,
+		NodeSelector:   r.Spec.NodeSelector,
+		Affinity:       r.Spec.Affinity,
+		TopologySpread: r.Spec.TopologySpread,
+		Tolerations:    r.Spec.Tolerations,
+		Scheduler:      r.Spec.Scheduler,
+		PriorityClass:  r.Spec.PriorityClass,
+	}, nil
+}
@@ -0,0 +1,71 @@
+package spec
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var byteSuffixes = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"Ki", 1 << 10},
+	{"Mi", 1 << 20},
+	{"Gi", 1 << 30},
+	{"Ti", 1 << 40},
+	{"K", 1000},
+	{"M", 1000 * 1000},
+	{"G", 1000 * 1000 * 1000},
+	{"T", 1000 * 1000 * 1000 * 1000},
+}
+
+// finite reports whether v is a usable quantity: not negative, NaN or
+// infinite, which ParseFloat all accept.
+func finite(v float64) bool {
+	return v >= 0 && !math.IsInf(v, 1)
+}
+
+// ParseBytes converts quantities such as 512Mi, 1G or 1048576 to bytes.
+func ParseBytes(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	for _, b := range byteSuffixes {
+		if !strings.HasSuffix(s, b.suffix) {
+			continue
+		}
+		v, err := strconv.ParseFloat(strings.TrimSuffix(s, b.suffix), 64)
+		if err != nil || !finite(v) {
+			return 0, fmt.Errorf("invalid quantity %s", s)
+		}
+		return int64(v * float64(b.multiplier)), nil
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid quantity %s", s)
+	}
+	return v, nil
+}
+
+// ParseCpu converts CPU quantities such as 500m or 1.5 to cores.
+func ParseCpu(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	if strings.HasSuffix(s, "m") {
+		v, err := strconv.ParseFloat(strings.TrimSuffix(s, "m"), 64)
+		if err != nil || !finite(v) {
+			return 0, fmt.Errorf("invalid cpu quantity %s", s)
+		}
+		return v / 1000, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || !finite(v) {
+		return 0, fmt.Errorf("invalid cpu quantity %s", s)
+	}
+	return v, nil
+}
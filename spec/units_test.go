@@ -0,0 +1,61 @@
+package spec
+
+import "testing"
+
+func TestParseBytes(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"1048576", 1 << 20, false},
+		{" 64Mi ", 64 << 20, false},
+		{"1Ki", 1024, false},
+		{"1.5Gi", 3 << 29, false},
+		{"2Ti", 2 << 40, false},
+		{"1K", 1000, false},
+		{"512M", 512000000, false},
+		{"1G", 1000000000, false},
+		{"1.5", 0, true},
+		{"-1", 0, true},
+		{"-1Mi", 0, true},
+		{"Mi", 0, true},
+		{"10MB", 0, true},
+		{"NaNMi", 0, true},
+		{"InfGi", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseBytes(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseBytes(%q) = %d, %v, want %d, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseCpu(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    float64
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"1", 1, false},
+		{"1.5", 1.5, false},
+		{"250m", 0.25, false},
+		{" 500m ", 0.5, false},
+		{"0", 0, false},
+		{"-1", 0, true},
+		{"-100m", 0, true},
+		{"m", 0, true},
+		{"1core", 0, true},
+		{"NaN", 0, true},
+		{"Inf", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseCpu(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseCpu(%q) = %g, %v, want %g, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -1,11 +1,13 @@
 package store
 
 import (
+	"bytes"
 	"cube/task"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"sync"
 
 	"github.com/boltdb/bolt"
 )
@@ -17,8 +19,11 @@ type Store interface {
 	Count() (int, error)
 }
 
+// InMemoryTaskStore is shared by the background loops of the manager and
+// the API handlers, so access to Db is guarded by mu.
 type InMemoryTaskStore struct {
 	Db map[string]*task.Task
+	mu sync.RWMutex
 }
 
 func NewInMemoryTaskStore() *InMemoryTaskStore {
@@ -32,11 +37,15 @@ func (i *InMemoryTaskStore) Put(key string, value interface{}) error {
 	if !ok {
 		return fmt.Errorf("value %v is not a task.Task type", value)
 	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
 	i.Db[key] = t
 	return nil
 }
 
 func (i *InMemoryTaskStore) Get(key string) (interface{}, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
 	t, ok := i.Db[key]
 	if !ok {
 		return nil, fmt.Errorf("task with key %s does not exists", key)
@@ -45,6 +54,8 @@ func (i *InMemoryTaskStore) Get(key string) (interface{}, error) {
 }
 
 func (i *InMemoryTaskStore) List() (interface{}, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
 	var tasks []*task.Task
 	for _, t := range i.Db {
 		tasks = append(tasks, t)
@@ -53,11 +64,14 @@ func (i *InMemoryTaskStore) List() (interface{}, error) {
 }
 
 func (i *InMemoryTaskStore) Count() (int, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
 	return len(i.Db), nil
 }
 
 type InMemoryTaskEventStore struct {
 	Db map[string]*task.TaskEvent
+	mu sync.RWMutex
 }
 
 func NewInMemoryTaskEventStore() *InMemoryTaskEventStore {
@@ -71,11 +85,15 @@ func (i *InMemoryTaskEventStore) Put(key string, value interface{}) error {
 	if !ok {
 		return fmt.Errorf("value %v is not *task.TaskEvent type", value)
 	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
 	i.Db[key] = e
 	return nil
 }
 
 func (i *InMemoryTaskEventStore) Get(key string) (interface{}, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
 	e, ok := i.Db[key]
 	if !ok {
 		return nil, fmt.Errorf("task event with key %s does not exists", key)
@@ -84,6 +102,8 @@ func (i *InMemoryTaskEventStore) Get(key string) (interface{}, error) {
 }
 
 func (i *InMemoryTaskEventStore) List() (interface{}, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
 	var events []*task.TaskEvent
 	for _, e := range i.Db {
 		events = append(events, e)
@@ -92,6 +112,8 @@ func (i *InMemoryTaskEventStore) List() (interface{}, error) {
 }
 
 func (i *InMemoryTaskEventStore) Count() (int, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
 	return len(i.Db), nil
 }
 
@@ -238,6 +260,47 @@ func NewEventStore(file string, mode os.FileMode, bucket string) (*EventStore, e
 	return &e, nil
 }
 
+// MigrateKeys moves tasks stored under a bare ID, from before tasks had
+// namespaces, to their key in the default namespace. Only the manager keys
+// tasks by namespace.
+func (t *TaskStore) MigrateKeys() error {
+	return migrateKeys(t.Db, t.Bucket)
+}
+
+// MigrateKeys moves events stored under a bare ID to their key in the
+// default namespace, like TaskStore.MigrateKeys.
+func (e *EventStore) MigrateKeys() error {
+	return migrateKeys(e.Db, e.Bucket)
+}
+
+func migrateKeys(db *bolt.DB, bucket string) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		var old [][]byte
+		b.ForEach(func(k, v []byte) error {
+			if !bytes.Contains(k, []byte("/")) {
+				old = append(old, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		for _, k := range old {
+			v := append([]byte(nil), b.Get(k)...)
+			err := b.Put([]byte(task.DefaultNamespace+"/"+string(k)), v)
+			if err != nil {
+				return err
+			}
+			err = b.Delete(k)
+			if err != nil {
+				return err
+			}
+		}
+		if len(old) > 0 {
+			log.Printf("moved %d entries of bucket %s to the %s namespace", len(old), bucket, task.DefaultNamespace)
+		}
+		return nil
+	})
+}
+
 func (e *EventStore) Close() {
 	e.Db.Close()
 }
@@ -0,0 +1,69 @@
+package store
+
+import (
+	"cube/task"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/google/uuid"
+)
+
+func TestTaskStoreMigrateKeys(t *testing.T) {
+	bare := task.Task{ID: uuid.New(), Name: "old"}
+	namespaced := task.Task{ID: uuid.New(), Name: "new", Namespace: "team-a"}
+
+	file := filepath.Join(t.TempDir(), "tasks.db")
+	db, err := bolt.Open(file, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("tasks"))
+		if err != nil {
+			return err
+		}
+		for key, tk := range map[string]task.Task{bare.ID.String(): bare, namespaced.Key(): namespaced} {
+			buf, _ := json.Marshal(tk)
+			err = b.Put([]byte(key), buf)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	s, err := NewTaskStore(file, 0600, "tasks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	err = s.MigrateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key   string
+		found bool
+	}{
+		{bare.ID.String(), false},
+		{task.Key("", bare.ID), true},
+		{namespaced.Key(), true},
+	}
+	for _, tt := range tests {
+		_, err := s.Get(tt.key)
+		if (err == nil) != tt.found {
+			t.Errorf("Get(%s) error = %v, want found %v", tt.key, err, tt.found)
+		}
+	}
+	n, err := s.Count()
+	if err != nil || n != 2 {
+		t.Errorf("Count() = %d, %v, want 2", n, err)
+	}
+}
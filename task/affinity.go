@@ -0,0 +1,175 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	OpIn     = "In"
+	OpNotIn  = "NotIn"
+	OpExists = "Exists"
+	OpEqual  = "Equal"
+)
+
+// LabelRequirement matches a set of labels. In and NotIn compare the value
+// of Key against Values, Exists only checks that Key is set.
+type LabelRequirement struct {
+	Key      string   `yaml:"key"`
+	Operator string   `yaml:"operator"`
+	Values   []string `yaml:"values,omitempty"`
+}
+
+// PreferredTerm adds Weight (1-100) to the score of nodes matching all of
+// its requirements.
+type PreferredTerm struct {
+	Weight       int                `yaml:"weight"`
+	Requirements []LabelRequirement `yaml:"requirements"`
+}
+
+// NodeAffinity restricts tasks to nodes matching every Required
+// requirement and favours nodes matching Preferred terms.
+type NodeAffinity struct {
+	Required  []LabelRequirement `yaml:"required,omitempty"`
+	Preferred []PreferredTerm    `yaml:"preferred,omitempty"`
+}
+
+// TaskAffinity expresses rules about the tasks already running on a node.
+// For affinity a node satisfies Required when it runs a task matching every
+// requirement; for anti-affinity when it runs none. Preferred terms are
+// scored the same way.
+type TaskAffinity struct {
+	Required  []LabelRequirement `yaml:"required,omitempty"`
+	Preferred []PreferredTerm    `yaml:"preferred,omitempty"`
+}
+
+type Affinity struct {
+	Node     *NodeAffinity `yaml:"node,omitempty"`
+	Task     *TaskAffinity `yaml:"task,omitempty"`
+	AntiTask *TaskAffinity `yaml:"antiTask,omitempty"`
+}
+
+func (r LabelRequirement) Matches(labels map[string]string) bool {
+	v, ok := labels[r.Key]
+	switch r.Operator {
+	case OpIn:
+		return ok && contains(r.Values, v)
+	case OpNotIn:
+		return !ok || !contains(r.Values, v)
+	case OpExists:
+		return ok
+	}
+	return false
+}
+
+func (r LabelRequirement) Validate() error {
+	if r.Key == "" {
+		return errors.New("label requirement without a key")
+	}
+	switch r.Operator {
+	case OpIn, OpNotIn:
+		if len(r.Values) == 0 {
+			return fmt.Errorf("operator %s on %s needs values", r.Operator, r.Key)
+		}
+	case OpExists:
+		if len(r.Values) > 0 {
+			return fmt.Errorf("operator %s on %s takes no values", r.Operator, r.Key)
+		}
+	default:
+		return fmt.Errorf("unknown operator %q on %s", r.Operator, r.Key)
+	}
+	return nil
+}
+
+// MatchesAll reports whether labels satisfy every requirement.
+func MatchesAll(reqs []LabelRequirement, labels map[string]string) bool {
+	for _, r := range reqs {
+		if !r.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func validateTerms(required []LabelRequirement, preferred []PreferredTerm) error {
+	for _, r := range required {
+		err := r.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	for _, p := range preferred {
+		if p.Weight < 1 || p.Weight > 100 {
+			return fmt.Errorf("preferred term weight %d is not between 1 and 100", p.Weight)
+		}
+		for _, r := range p.Requirements {
+			err := r.Validate()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (a *Affinity) Validate() error {
+	if a == nil {
+		return nil
+	}
+	if a.Node != nil {
+		err := validateTerms(a.Node.Required, a.Node.Preferred)
+		if err != nil {
+			return err
+		}
+	}
+	for _, ta := range []*TaskAffinity{a.Task, a.AntiTask} {
+		if ta == nil {
+			continue
+		}
+		err := validateTerms(ta.Required, ta.Preferred)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidatePlacement checks the labels, node selector, affinity rules,
+// spread constraints, tolerations and priority class of a task.
+func (t *Task) ValidatePlacement() error {
+	for k := range t.Labels {
+		if k == "" {
+			return errors.New("label with an empty key")
+		}
+	}
+	for k := range t.NodeSelector {
+		if k == "" {
+			return errors.New("node selector with an empty key")
+		}
+	}
+	for _, c := range t.TopologySpread {
+		err := c.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	for _, tol := range t.Tolerations {
+		err := tol.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	if _, ok := PriorityClasses[t.PriorityClass]; t.PriorityClass != "" && !ok {
+		return fmt.Errorf("unknown priority class %q", t.PriorityClass)
+	}
+	return t.Affinity.Validate()
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
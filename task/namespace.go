@@ -0,0 +1,46 @@
+package task
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/google/uuid"
+)
+
+// DefaultNamespace holds the tasks and services created without a
+// namespace.
+const DefaultNamespace = "default"
+
+var namespacePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// ValidateNamespace checks that a namespace is a DNS label, since it is
+// part of store keys and service discovery names.
+func ValidateNamespace(namespace string) error {
+	if len(namespace) > 63 || !namespacePattern.MatchString(namespace) {
+		return fmt.Errorf("invalid namespace %q: use lower case letters, digits and dashes", namespace)
+	}
+	return nil
+}
+
+// NamespaceOf returns namespace, or the default namespace if it is empty.
+func NamespaceOf(namespace string) string {
+	if namespace == "" {
+		return DefaultNamespace
+	}
+	return namespace
+}
+
+// Key returns the store key of the task or task event with the given ID in
+// a namespace.
+func Key(namespace string, id uuid.UUID) string {
+	return NamespaceOf(namespace) + "/" + id.String()
+}
+
+func (t *Task) Key() string {
+	return Key(t.Namespace, t.ID)
+}
+
+// InNamespace reports whether t belongs to namespace.
+func (t *Task) InNamespace(namespace string) bool {
+	return NamespaceOf(t.Namespace) == NamespaceOf(namespace)
+}
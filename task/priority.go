@@ -0,0 +1,23 @@
+package task
+
+const DefaultPriorityClass = "normal"
+
+// PriorityClasses maps the priority classes a task can name to their
+// priority. Tasks of a higher priority are scheduled first and may preempt
+// tasks of a lower priority when they do not fit anywhere.
+var PriorityClasses = map[string]int{
+	"best-effort": 0,
+	"normal":      1000,
+	"high":        10000,
+	"critical":    100000,
+}
+
+// Priority returns the priority of the class of t, the default class if
+// none is set.
+func (t *Task) Priority() int {
+	class := t.PriorityClass
+	if class == "" {
+		class = DefaultPriorityClass
+	}
+	return PriorityClasses[class]
+}
@@ -0,0 +1,48 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	DoNotSchedule  = "DoNotSchedule"
+	ScheduleAnyway = "ScheduleAnyway"
+)
+
+// SpreadConstraint keeps the tasks matching Selector balanced across the
+// domains formed by the values of the TopologyKey node label: the count in
+// any domain may exceed the smallest count by at most MaxSkew. Without a
+// selector the tasks of the same service are counted. DoNotSchedule makes
+// the constraint hard, ScheduleAnyway only scores against skewed domains.
+type SpreadConstraint struct {
+	MaxSkew           int                `yaml:"maxSkew"`
+	TopologyKey       string             `yaml:"topologyKey"`
+	WhenUnsatisfiable string             `yaml:"whenUnsatisfiable,omitempty"`
+	Selector          []LabelRequirement `yaml:"selector,omitempty"`
+}
+
+func (c SpreadConstraint) Hard() bool {
+	return c.WhenUnsatisfiable != ScheduleAnyway
+}
+
+func (c SpreadConstraint) Validate() error {
+	if c.TopologyKey == "" {
+		return errors.New("spread constraint without a topology key")
+	}
+	if c.MaxSkew < 1 {
+		return fmt.Errorf("spread constraint on %s needs a maxSkew of at least 1", c.TopologyKey)
+	}
+	switch c.WhenUnsatisfiable {
+	case "", DoNotSchedule, ScheduleAnyway:
+	default:
+		return fmt.Errorf("unknown whenUnsatisfiable %q on %s", c.WhenUnsatisfiable, c.TopologyKey)
+	}
+	for _, r := range c.Selector {
+		err := r.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
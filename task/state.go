@@ -2,10 +2,11 @@ package task
 
 var stateTransitionMap = map[State][]State{
 	Pending:   []State{Scheduled},
-	Scheduled: []State{Scheduled, Running, Failed},
-	Running:   []State{Running, Completed, Failed},
+	Scheduled: []State{Scheduled, Running, Completed, Failed, Lost},
+	Running:   []State{Running, Completed, Failed, Lost},
 	Completed: []State{},
 	Failed:    []State{},
+	Lost:      []State{Scheduled},
 }
 
 func Contains(states []State, state State) bool {
@@ -20,3 +21,21 @@ func Contains(states []State, state State) bool {
 func ValidStateTransition(src State, dst State) bool {
 	return Contains(stateTransitionMap[src], dst)
 }
+
+func (s State) String() string {
+	switch s {
+	case Pending:
+		return "Pending"
+	case Scheduled:
+		return "Scheduled"
+	case Running:
+		return "Running"
+	case Completed:
+		return "Completed"
+	case Failed:
+		return "Failed"
+	case Lost:
+		return "Lost"
+	}
+	return "Unknown"
+}
@@ -0,0 +1,31 @@
+package task
+
+import "testing"
+
+func TestValidStateTransition(t *testing.T) {
+	tests := []struct {
+		src  State
+		dst  State
+		want bool
+	}{
+		{Pending, Scheduled, true},
+		{Pending, Running, false},
+		{Scheduled, Running, true},
+		// a short task can exit between two polls of its worker
+		{Scheduled, Completed, true},
+		{Scheduled, Failed, true},
+		{Scheduled, Lost, true},
+		{Running, Completed, true},
+		{Running, Scheduled, false},
+		{Completed, Running, false},
+		{Failed, Scheduled, false},
+		{Lost, Scheduled, true},
+		{Lost, Running, false},
+	}
+	for _, tt := range tests {
+		got := ValidStateTransition(tt.src, tt.dst)
+		if got != tt.want {
+			t.Errorf("ValidStateTransition(%v, %v) = %v, want %v", tt.src, tt.dst, got, tt.want)
+		}
+	}
+}
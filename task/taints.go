@@ -0,0 +1,58 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Toleration lets a task be scheduled on, and keep running on, nodes with a
+// matching taint. Equal (the default) compares Key and Value, Exists only
+// Key; an empty Key with Exists tolerates every taint. An empty Effect
+// matches all effects.
+type Toleration struct {
+	Key      string `yaml:"key,omitempty"`
+	Operator string `yaml:"operator,omitempty"`
+	Value    string `yaml:"value,omitempty"`
+	Effect   string `yaml:"effect,omitempty"`
+}
+
+// Tolerates reports whether the toleration matches a taint.
+func (tol Toleration) Tolerates(key, value, effect string) bool {
+	if tol.Effect != "" && tol.Effect != effect {
+		return false
+	}
+	if tol.Operator == OpExists {
+		return tol.Key == "" || tol.Key == key
+	}
+	return tol.Key == key && tol.Value == value
+}
+
+func (tol Toleration) Validate() error {
+	switch tol.Operator {
+	case "", OpEqual:
+		if tol.Key == "" {
+			return errors.New("toleration with operator Equal needs a key")
+		}
+	case OpExists:
+		if tol.Value != "" {
+			return fmt.Errorf("toleration on %s with operator Exists takes no value", tol.Key)
+		}
+	default:
+		return fmt.Errorf("unknown toleration operator %q on %s", tol.Operator, tol.Key)
+	}
+	switch tol.Effect {
+	case "", "NoSchedule", "PreferNoSchedule", "NoExecute":
+		return nil
+	}
+	return fmt.Errorf("unknown toleration effect %q on %s", tol.Effect, tol.Key)
+}
+
+// Tolerates reports whether any toleration of t matches the taint.
+func (t *Task) Tolerates(key, value, effect string) bool {
+	for _, tol := range t.Tolerations {
+		if tol.Tolerates(key, value, effect) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,6 +2,8 @@ package task
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"io"
 	"log"
 	"os"
@@ -23,25 +25,50 @@ const (
 	Running
 	Completed
 	Failed
+	Lost
 )
 
 type Task struct {
-	ID            uuid.UUID
-	ContainerID   string
-	Name          string
-	State         State
-	Image         string
-	Cpu           float64
-	Memory        int64
-	Disk          int64
-	ExposedPorts  nat.PortSet
-	HostPorts     nat.PortMap
-	PortBindings  map[string]string
-	RestartPolicy string
-	StartTime     time.Time
-	FinishTime    time.Time
-	HealthCheck   string
-	RestartCount  int
+	ID             uuid.UUID
+	ContainerID    string
+	Name           string
+	Namespace      string
+	State          State
+	Image          string
+	Cpu            float64
+	Memory         int64
+	Disk           int64
+	ExposedPorts   nat.PortSet
+	HostPorts      nat.PortMap
+	PortBindings   map[string]string
+	RestartPolicy  string
+	StartTime      time.Time
+	FinishTime     time.Time
+	HealthCheck    string
+	RestartCount   int
+	Service        string
+	Revision       int
+	Labels         map[string]string
+	NodeSelector   map[string]string
+	Affinity       *Affinity
+	TopologySpread []SpreadConstraint
+	Tolerations    []Toleration
+	Scheduler      string
+	PriorityClass  string
+	Node           string
+	Scheduling     []SchedulingAttempt
+}
+
+// SchedulingAttempt explains one attempt to place a task: why nodes were
+// filtered out and the score breakdown of the remaining candidates, where
+// lower is better.
+type SchedulingAttempt struct {
+	Time      time.Time
+	Scheduler string
+	Node      string
+	Filtered  map[string]string
+	Scores    map[string]map[string]float64
+	Error     string
 }
 
 type TaskEvent struct {
@@ -62,6 +89,7 @@ type Config struct {
 	Disk          int64
 	Env           []string
 	RestartPolicy string
+	PortBindings  map[string]string
 }
 
 type Docker struct {
@@ -81,11 +109,24 @@ type DockerInspectResponse struct {
 	Container *types.ContainerJSON
 }
 
+type ContainerStats struct {
+	CpuCores    float64
+	OnlineCpus  int
+	MemoryUsage int64
+	MemoryLimit int64
+}
+
+type DockerStatsResponse struct {
+	Error error
+	Stats *ContainerStats
+}
+
 func NewConfig(t *Task) *Config {
 	return &Config{
 		Name:          t.Name,
 		Image:         t.Image,
 		RestartPolicy: t.RestartPolicy,
+		PortBindings:  t.PortBindings,
 	}
 }
 
@@ -123,6 +164,10 @@ func (d *Docker) Run() DockerResult {
 		RestartPolicy:   rp,
 		Resources:       r,
 		PublishAllPorts: true,
+		PortBindings:    nat.PortMap{},
+	}
+	for containerPort, hostPort := range d.Config.PortBindings {
+		hc.PortBindings[nat.Port(containerPort)] = []nat.PortBinding{{HostPort: hostPort}}
 	}
 
 	resp, err := d.Client.ContainerCreate(ctx, &cc, &hc, nil, nil, d.Config.Name)
@@ -199,3 +244,61 @@ func (d *Docker) Inspect(containerID string) DockerInspectResponse {
 	}
 	return DockerInspectResponse{Container: &resp}
 }
+
+func (d *Docker) Stats(containerID string) DockerStatsResponse {
+	ctx := context.Background()
+	resp, err := d.Client.ContainerStats(ctx, containerID, false)
+	if err != nil {
+		log.Printf("Error getting stats for container %s: %v\n", containerID, err)
+		return DockerStatsResponse{Error: err}
+	}
+	defer resp.Body.Close()
+
+	var s types.StatsJSON
+	err = json.NewDecoder(resp.Body).Decode(&s)
+	if err != nil {
+		log.Printf("Error decoding stats for container %s: %v\n", containerID, err)
+		return DockerStatsResponse{Error: err}
+	}
+
+	// the daemon samples twice when not streaming, so the difference between
+	// the two readings gives the share of the host's CPUs that was used
+	cpus := int(s.CPUStats.OnlineCPUs)
+	if cpus == 0 {
+		cpus = len(s.CPUStats.CPUUsage.PercpuUsage)
+	}
+	var cores float64
+	cpuDelta := float64(s.CPUStats.CPUUsage.TotalUsage) - float64(s.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(s.CPUStats.SystemUsage) - float64(s.PreCPUStats.SystemUsage)
+	if cpuDelta > 0 && systemDelta > 0 {
+		cores = cpuDelta / systemDelta * float64(cpus)
+	}
+
+	return DockerStatsResponse{
+		Stats: &ContainerStats{
+			CpuCores:    cores,
+			OnlineCpus:  cpus,
+			MemoryUsage: int64(s.MemoryStats.Usage),
+			MemoryLimit: int64(s.MemoryStats.Limit),
+		},
+	}
+}
+
+func (d *Docker) Logs(containerID string, follow bool) (io.ReadCloser, error) {
+	ctx := context.Background()
+	return d.Client.ContainerLogs(ctx, containerID, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Timestamps: true,
+		Follow:     follow,
+	})
+}
+
+// BoundPorts returns the host ports the task binds, as port/proto.
+func (t *Task) BoundPorts() []string {
+	var ports []string
+	for containerPort, hostPort := range t.PortBindings {
+		ports = append(ports, fmt.Sprintf("%s/%s", hostPort, nat.Port(containerPort).Proto()))
+	}
+	return ports
+}
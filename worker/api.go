@@ -21,6 +21,8 @@ func (a *Api) initRouter() {
 		r.Get("/", a.GetTasksHandler)
 		r.Route("/{taskID}", func(r chi.Router) {
 			r.Delete("/", a.StopTaskHandler)
+			r.Get("/stats", a.GetTaskStatsHandler)
+			r.Get("/logs", a.GetTaskLogsHandler)
 		})
 	})
 	a.Router.Route("/stats", func(r chi.Router) {
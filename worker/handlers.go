@@ -4,9 +4,11 @@ import (
 	"cube/task"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/go-chi/chi"
 	"github.com/google/uuid"
 )
@@ -71,3 +73,87 @@ func (a *Api) GetStatsHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(200)
 	json.NewEncoder(w).Encode(a.Worker.Stats)
 }
+
+func (a *Api) GetTaskStatsHandler(w http.ResponseWriter, r *http.Request) {
+	taskID := chi.URLParam(r, "taskID")
+	tID, _ := uuid.Parse(taskID)
+	result, err := a.Worker.Db.Get(tID.String())
+	if err != nil {
+		log.Printf("No task with ID %v found", tID)
+		w.WriteHeader(404)
+		return
+	}
+
+	t := result.(*task.Task)
+	if t.State != task.Running {
+		msg := fmt.Sprintf("Task %v is not running\n", tID)
+		log.Printf("%v", msg)
+		w.WriteHeader(409)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 409, Message: msg})
+		return
+	}
+
+	resp := a.Worker.StatsTask(*t)
+	if resp.Error != nil {
+		msg := fmt.Sprintf("Error getting stats for task %v: %v\n", tID, resp.Error)
+		log.Printf("%v", msg)
+		w.WriteHeader(500)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 500, Message: msg})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(resp.Stats)
+}
+
+func (a *Api) GetTaskLogsHandler(w http.ResponseWriter, r *http.Request) {
+	taskID := chi.URLParam(r, "taskID")
+	tID, _ := uuid.Parse(taskID)
+	result, err := a.Worker.Db.Get(tID.String())
+	if err != nil {
+		log.Printf("No task with ID %v found", tID)
+		w.WriteHeader(404)
+		return
+	}
+
+	t := result.(*task.Task)
+	if t.ContainerID == "" {
+		msg := fmt.Sprintf("Task %v has no container\n", tID)
+		log.Printf("%v", msg)
+		w.WriteHeader(409)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 409, Message: msg})
+		return
+	}
+
+	follow := r.URL.Query().Get("follow") == "true"
+	logs, err := a.Worker.LogsTask(*t, follow)
+	if err != nil {
+		msg := fmt.Sprintf("Error getting logs for task %v: %v\n", tID, err)
+		log.Printf("%v", msg)
+		w.WriteHeader(500)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 500, Message: msg})
+		return
+	}
+	defer logs.Close()
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(200)
+	out := io.Writer(w)
+	if f, ok := w.(http.Flusher); ok {
+		out = flushWriter{w: w, f: f}
+	}
+	stdcopy.StdCopy(out, out, logs)
+}
+
+// flushWriter flushes after every write so followed logs reach the client
+// as they are produced.
+type flushWriter struct {
+	w io.Writer
+	f http.Flusher
+}
+
+func (fw flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	fw.f.Flush()
+	return n, err
+}
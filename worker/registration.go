@@ -0,0 +1,126 @@
+package worker
+
+import (
+	"bytes"
+	"cube/node"
+	"cube/stats"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+	"time"
+)
+
+func (w *Worker) registration() node.Registration {
+	w.configMu.RLock()
+	defer w.configMu.RUnlock()
+	reg := node.Registration{
+		Name:    w.Config.Name,
+		Address: w.Config.Advertise,
+		Cpu:     float64(runtime.NumCPU()),
+		Labels:  w.Config.Labels,
+	}
+	for _, s := range w.Config.Taints {
+		taint, err := node.ParseTaint(s)
+		if err != nil {
+			log.Printf("[worker] ignoring taint: %v", err)
+			continue
+		}
+		reg.Taints = append(reg.Taints, taint)
+	}
+	s := stats.GetStats()
+	if s.MemStats != nil {
+		reg.Memory = int64(s.MemTotalKb())
+	}
+	if s.DiskStats != nil {
+		reg.Disk = int64(s.DiskTotal())
+	}
+	return reg
+}
+
+func (w *Worker) manager() string {
+	w.configMu.RLock()
+	defer w.configMu.RUnlock()
+	return w.Config.Manager
+}
+
+func (w *Worker) register(manager string) error {
+	data, err := json.Marshal(w.registration())
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("http://%s/nodes", manager)
+	resp, err := http.Post(url, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("manager %s returned %d", manager, resp.StatusCode)
+	}
+	return nil
+}
+
+// heartbeat tells the manager the worker is still alive. It reports false
+// when the manager no longer knows the worker and it has to register again.
+func (w *Worker) heartbeat(manager string) (bool, error) {
+	url := fmt.Sprintf("http://%s/nodes/%s/heartbeat", manager, w.registration().Address)
+	resp, err := http.Post(url, "application/json", nil)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return true, fmt.Errorf("manager %s returned %d", manager, resp.StatusCode)
+}
+
+// Heartbeats registers the worker with its manager and keeps sending
+// heartbeats. The worker registers again whenever the manager has forgotten
+// it or its labels were reloaded.
+func (w *Worker) Heartbeats() {
+	for {
+		manager := w.manager()
+		if manager != "" {
+			if !w.isRegistered() {
+				err := w.register(manager)
+				if err != nil {
+					log.Printf("[worker] error registering with manager %s: %v", manager, err)
+				} else {
+					log.Printf("[worker] registered with manager %s", manager)
+					w.setRegistered(true)
+				}
+			} else {
+				known, err := w.heartbeat(manager)
+				if err != nil {
+					log.Printf("[worker] error sending heartbeat to manager %s: %v", manager, err)
+				}
+				if !known {
+					log.Printf("[worker] manager %s does not know this worker, registering again", manager)
+					w.setRegistered(false)
+					continue
+				}
+			}
+		}
+		d := w.intervals().Heartbeat.Duration
+		log.Printf("Sleeping for %v", d)
+		time.Sleep(d)
+	}
+}
+
+func (w *Worker) isRegistered() bool {
+	w.configMu.RLock()
+	defer w.configMu.RUnlock()
+	return w.registered
+}
+
+func (w *Worker) setRegistered(registered bool) {
+	w.configMu.Lock()
+	defer w.configMu.Unlock()
+	w.registered = registered
+}
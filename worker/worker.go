@@ -1,23 +1,30 @@
 package worker
 
 import (
+	"cube/config"
 	"cube/stats"
 	"cube/store"
 	"cube/task"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"reflect"
+	"sync"
 	"time"
 
 	"github.com/golang-collections/collections/queue"
 )
 
 type Worker struct {
-	Queue     queue.Queue
-	Db        store.Store
-	TaskCount int
-	Name      string
-	Stats     *stats.Stats
+	Queue      queue.Queue
+	Db         store.Store
+	TaskCount  int
+	Name       string
+	Stats      *stats.Stats
+	Config     config.Worker
+	configMu   sync.RWMutex
+	registered bool
 }
 
 func (w *Worker) AddTask(t task.Task) {
@@ -29,25 +36,60 @@ func (w *Worker) CollectStats() {
 		log.Println("Collecting stats")
 		w.Stats = stats.GetStats()
 		w.TaskCount = w.Stats.TaskCount
-		time.Sleep(15 * time.Second)
+		time.Sleep(w.intervals().CollectStats.Duration)
 	}
 }
 
-func New(name string, taskDbType string) *Worker {
+func New(c config.Worker) *Worker {
 	w := Worker{
-		Name:  name,
-		Queue: *queue.New(),
+		Name:   c.Name,
+		Queue:  *queue.New(),
+		Config: c,
 	}
 	var s store.Store
-	//var err error
-	switch taskDbType {
+	var err error
+	switch c.Store.Type {
 	case "memory":
 		s = store.NewInMemoryTaskStore()
+	case "persistent":
+		filename := c.Store.TaskFile
+		if filename == "" {
+			filename = fmt.Sprintf("%s_tasks.db", c.Name)
+		}
+		s, err = store.NewTaskStore(filename, 0600, "tasks")
+	}
+	if err != nil {
+		log.Fatalf("unable to create task store: %v", err)
 	}
 	w.Db = s
 	return &w
 }
 
+func (w *Worker) intervals() config.WorkerIntervals {
+	w.configMu.RLock()
+	defer w.configMu.RUnlock()
+	return w.Config.Intervals
+}
+
+// Reload applies the settings of c that can change while the worker is
+// running. Changes to other settings are reported and ignored.
+func (w *Worker) Reload(c config.Worker) {
+	w.configMu.Lock()
+	defer w.configMu.Unlock()
+	if w.Config.Host != c.Host || w.Config.Port != c.Port || w.Config.Name != c.Name || w.Config.Advertise != c.Advertise || w.Config.Store != c.Store {
+		log.Printf("[worker] address, name or store settings changed, restart the worker to apply them")
+	}
+	log.Printf("[worker] reloaded intervals: %+v", c.Intervals)
+	w.Config.Intervals = c.Intervals
+	if w.Config.Manager != c.Manager || !reflect.DeepEqual(w.Config.Labels, c.Labels) || !reflect.DeepEqual(w.Config.Taints, c.Taints) {
+		log.Printf("[worker] manager, labels or taints changed, registering again")
+		w.Config.Manager = c.Manager
+		w.Config.Labels = c.Labels
+		w.Config.Taints = c.Taints
+		w.registered = false
+	}
+}
+
 func (w *Worker) runTask() task.DockerResult {
 	t := w.Queue.Dequeue()
 	if t == nil {
@@ -114,6 +156,7 @@ func (w *Worker) StartTask(t task.Task) task.DockerResult {
 	}
 	t.ContainerID = result.ContainerId
 	t.State = task.Running
+	t.StartTime = time.Now().UTC()
 	w.Db.Put(t.ID.String(), &t)
 
 	return result
@@ -156,8 +199,9 @@ func (w *Worker) RunTasks() {
 		} else {
 			log.Printf("No tasks to process currently.\n")
 		}
-		log.Println("Sleeping for 10 seconds.")
-		time.Sleep(10 * time.Second)
+		d := w.intervals().RunTasks.Duration
+		log.Printf("Sleeping for %v.", d)
+		time.Sleep(d)
 	}
 
 }
@@ -168,6 +212,18 @@ func (w *Worker) InspectTask(t task.Task) task.DockerInspectResponse {
 	return d.Inspect(t.ContainerID)
 }
 
+func (w *Worker) StatsTask(t task.Task) task.DockerStatsResponse {
+	config := task.NewConfig(&t)
+	d := task.NewDocker(config)
+	return d.Stats(t.ContainerID)
+}
+
+func (w *Worker) LogsTask(t task.Task, follow bool) (io.ReadCloser, error) {
+	config := task.NewConfig(&t)
+	d := task.NewDocker(config)
+	return d.Logs(t.ContainerID, follow)
+}
+
 func (w *Worker) updateTasks() {
 	// for each task in the worker's datastore:
 	// 1. call InspectTask method
@@ -189,12 +245,19 @@ func (w *Worker) updateTasks() {
 				log.Printf("No container for running task %s", t.ID)
 				t.State = task.Failed
 				w.Db.Put(t.ID.String(), t)
+				continue
 			}
 
 			if resp.Container.State.Status == "exited" {
 				log.Printf("Container for task %s in non-running state %s", t.ID, resp.Container.State.Status)
-				t.State = task.Failed
+				if resp.Container.State.ExitCode == 0 {
+					t.State = task.Completed
+				} else {
+					t.State = task.Failed
+				}
+				t.FinishTime = time.Now().UTC()
 				w.Db.Put(t.ID.String(), t)
+				continue
 			}
 
 			// task is running, update exposed ports
@@ -208,7 +271,8 @@ func (w *Worker) UpdateTasks() {
 		log.Println("Checking status of tasks")
 		w.updateTasks()
 		log.Println("Task updates completed")
-		log.Println("Sleeping for 15 seconds")
-		time.Sleep(15 * time.Second)
+		d := w.intervals().UpdateTasks.Duration
+		log.Printf("Sleeping for %v", d)
+		time.Sleep(d)
 	}
 }